@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
@@ -19,11 +20,25 @@ import (
 	"nf-shard-orchestrator/graph/model"
 	"nf-shard-orchestrator/pkg/auth"
 	"nf-shard-orchestrator/pkg/cache"
+	"nf-shard-orchestrator/pkg/pipelineschema"
+	"nf-shard-orchestrator/pkg/queue"
+	"nf-shard-orchestrator/pkg/retry"
+	"nf-shard-orchestrator/pkg/revision"
 	"nf-shard-orchestrator/pkg/runner"
 	"nf-shard-orchestrator/pkg/runner/float"
+	"nf-shard-orchestrator/pkg/runner/hpc"
+	"nf-shard-orchestrator/pkg/runner/k8s"
+	"nf-shard-orchestrator/pkg/runner/local"
 	"nf-shard-orchestrator/pkg/runner/nextflow"
+	"nf-shard-orchestrator/pkg/runs"
+	"nf-shard-orchestrator/pkg/schedules"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"nf-shard-orchestrator/pkg/templates"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -46,29 +61,101 @@ func main() {
 		panic("PORT environment variable is not set")
 	}
 
+	dataDir := os.Getenv("DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
 	logOpts := &slog.HandlerOptions{Level: slog.LevelDebug}
 	logger := slog.New(slog.NewTextHandler(os.Stdout, logOpts))
 
-	nc, _, js, err := RunEmbeddedNatsServer()
+	nc, _, js, err := RunEmbeddedNatsServer(dataDir)
 	if err != nil {
 		logger.Error("Failed to start NATS srv", "error", err)
 		return
 	}
 
+	logMaxAge, logMaxBytes, err := logRetention()
+	if err != nil {
+		logger.Error("Invalid log retention", "error", err)
+		return
+	}
+
+	_, err = logstream.CreateStream(context.Background(), js, logMaxAge, logMaxBytes)
+	if err != nil {
+		logger.Error("Failed to create log stream", "error", err)
+		return
+	}
+
+	logCacheCfg, err := logCacheConfig()
+	if err != nil {
+		logger.Error("Invalid log cache config", "error", err)
+		return
+	}
+
+	logCache := cache.NewCache[model.Log](logCacheCfg)
+	expvar.Publish("log_cache", expvar.Func(func() any { return logCache.Stats() }))
+	logHistory := logstream.NewHistory(js, logCache)
+
+	runStore, err := runs.NewStore(context.Background(), nc, js, logger)
+	if err != nil {
+		logger.Error("Failed to create run store", "error", err)
+		return
+	}
+
+	scheduleStore, err := schedules.NewStore(context.Background(), js)
+	if err != nil {
+		logger.Error("Failed to create schedule store", "error", err)
+		return
+	}
+
+	templateStore, err := templates.NewStore(context.Background(), js)
+	if err != nil {
+		logger.Error("Failed to create launch template store", "error", err)
+		return
+	}
+
+	err = runStore.Reconcile(context.Background(), runAlive(logger))
+	if err != nil {
+		logger.Error("Failed to reconcile runs", "error", err)
+	}
+
+	runSub, err := runStore.Watch()
+	if err != nil {
+		logger.Error("Failed to watch run events", "error", err)
+		return
+	}
+	defer runSub.Unsubscribe()
+
+	expireSub, err := runs.SubscribeStatus(nc, logger, func(status model.RunStatus) {
+		if runs.IsTerminal(status.State) {
+			logHistory.Expire(status.RunName)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to watch run status", "error", err)
+		return
+	}
+	defer expireSub.Unsubscribe()
+
 	var wg sync.WaitGroup
 
-	logCache := cache.NewCache[model.Log]()
+	launchDir, err := nextflowLaunchDir(dataDir)
+	if err != nil {
+		logger.Error("Invalid nextflow launch directory", "error", err)
+		return
+	}
 
 	nfRunnerConfig := nextflow.Config{
-		Wg:       &wg,
-		Logger:   logger,
-		BinPath:  "nextflow",
-		Nc:       nc,
-		Js:       js,
-		LogCache: logCache,
+		Wg:      &wg,
+		Logger:  logger,
+		BinPath: "nextflow",
+		Nc:      nc,
+		Js:      js,
+		BaseDir: launchDir,
 	}
 	nfService := nextflow.NewRunner(nfRunnerConfig)
 
@@ -79,11 +166,174 @@ func main() {
 		NextflowBinPath: "nextflow",
 		Nc:              nc,
 		Js:              js,
-		LogCache:        logCache,
 	}
 	floatService := float.NewRunner(floatConfig)
 
-	go RunGraphQLServer(nc, js, logger, nfService, floatService, &wg, port, logCache)
+	localConfig, err := localRunnerConfig(dataDir)
+	if err != nil {
+		logger.Error("Invalid local runner config", "error", err)
+		return
+	}
+	localConfig.Logger = logger
+	localConfig.Nextflow = nfService
+	localService := local.NewRunner(localConfig)
+
+	runners := runner.NewRegistry()
+	err = runners.Register(nfService, runner.Capabilities{CanStop: true, CanResume: true, NeedsMock: true}, "awsbatch", "google-batch")
+	if err != nil {
+		logger.Error("Failed to register runner", "error", err)
+		return
+	}
+	err = runners.Register(floatService, runner.Capabilities{CanStop: true, NeedsMock: true}, "float")
+	if err != nil {
+		logger.Error("Failed to register runner", "error", err)
+		return
+	}
+	err = runners.Register(localService, runner.Capabilities{CanStop: true, CanResume: true}, "local")
+	if err != nil {
+		logger.Error("Failed to register runner", "error", err)
+		return
+	}
+
+	// kubernetes runs are only available when a namespace is configured
+	if namespace := os.Getenv("K8S_NAMESPACE"); namespace != "" {
+		k8sService, err := k8s.NewRunner(k8sRunnerConfig(namespace, logger, nfService))
+		if err != nil {
+			logger.Error("Invalid kubernetes runner config", "error", err)
+			return
+		}
+
+		err = runners.Register(k8sService, runner.Capabilities{CanStop: true, CanResume: true, NeedsMock: true}, "k8s")
+		if err != nil {
+			logger.Error("Failed to register runner", "error", err)
+			return
+		}
+	}
+
+	followers := map[string]jobFollower{"float": floatService}
+
+	// batch scheduler runs are only available when a scheduler is configured
+	if scheduler := os.Getenv("HPC_SCHEDULER"); scheduler != "" {
+		hpcConfig, err := hpcRunnerConfig(hpc.Scheduler(scheduler))
+		if err != nil {
+			logger.Error("Invalid hpc runner config", "error", err)
+			return
+		}
+		hpcConfig.Logger = logger
+		hpcConfig.Wg = &wg
+		hpcConfig.Nc = nc
+		hpcConfig.Js = js
+
+		hpcService, err := hpc.NewRunner(hpcConfig)
+		if err != nil {
+			logger.Error("Invalid hpc runner config", "error", err)
+			return
+		}
+
+		err = runners.Register(hpcService, runner.Capabilities{CanStop: true, CanResume: true, NeedsMock: true}, hpcService.Executor())
+		if err != nil {
+			logger.Error("Failed to register runner", "error", err)
+			return
+		}
+		followers[hpcService.Executor()] = hpcService
+	}
+
+	err = resumeRuns(context.Background(), runStore, followers)
+	if err != nil {
+		logger.Error("Failed to resume runs", "error", err)
+	}
+
+	limits, err := queueLimits()
+	if err != nil {
+		logger.Error("Invalid run queue limits", "error", err)
+		return
+	}
+
+	preemption, err := envBool("RUN_PREEMPTION", false)
+	if err != nil {
+		logger.Error("Invalid run preemption setting", "error", err)
+		return
+	}
+
+	retryPolicies, err := launchRetryPolicies()
+	if err != nil {
+		logger.Error("Invalid launch retry policy", "error", err)
+		return
+	}
+
+	// previews run nextflow on the worker, at least one at a time
+	maxPreviews, err := envInt("MAX_PREVIEWS", 2)
+	if err != nil || maxPreviews < 1 {
+		logger.Error("Invalid preview limit", "max_previews", maxPreviews, "error", err)
+		return
+	}
+
+	runQueue := queue.New[runner.RunConfig](limits)
+	expvar.Publish("run_queue", expvar.Func(func() any { return runQueue.Stats() }))
+
+	// runs of a previous worker that are still alive hold their slots
+	err = trackActiveRuns(context.Background(), runStore, runQueue)
+	if err != nil {
+		logger.Error("Failed to track active runs", "error", err)
+	}
+
+	resolver := &graph.Resolver{
+		NatsConn:        nc,
+		Logger:          logger,
+		Runners:         runners,
+		NextflowBinPath: nfService.BinPath(),
+		Wg:              &wg,
+		Nc:              nc,
+		Js:              js,
+		RunStore:        runStore,
+		LogHistory:      logHistory,
+		RunQueue:        runQueue,
+		Preemption:      preemption,
+		Previews:        make(chan struct{}, maxPreviews),
+		Retry:           retryPolicies,
+		ScheduleStore:   scheduleStore,
+		TemplateStore:   templateStore,
+		Revisions:       &revision.Resolver{GitBinPath: "git"},
+		Schemas: &pipelineschema.Fetcher{
+			GitBinPath: "git",
+			Cache:      cache.NewCache[[]byte](cache.Config{MaxItemsPerKey: 1, MaxKeys: schemaCacheSize}),
+		},
+	}
+
+	queueSub, err := resolver.WatchQueue()
+	if err != nil {
+		logger.Error("Failed to watch run queue", "error", err)
+		return
+	}
+	defer queueSub.Unsubscribe()
+
+	logSub, err := resolver.CaptureLogs()
+	if err != nil {
+		logger.Error("Failed to watch finished runs", "error", err)
+		return
+	}
+	defer logSub.Unsubscribe()
+
+	err = resolver.RequeueRuns(context.Background())
+	if err != nil {
+		logger.Error("Failed to queue waiting runs", "error", err)
+	}
+
+	resolver.Scheduler = schedules.NewScheduler(schedules.Config{
+		Logger:   logger,
+		Nc:       nc,
+		Store:    scheduleStore,
+		RunStore: runStore,
+		Fire:     resolver.FireSchedule,
+	})
+	err = resolver.Scheduler.Start(context.Background())
+	if err != nil {
+		logger.Error("Failed to start scheduler", "error", err)
+		return
+	}
+	defer resolver.Scheduler.Stop()
+
+	go RunGraphQLServer(resolver, port)
 
 	<-sigs
 	logger.Info("Shutdown signal received")
@@ -102,9 +352,294 @@ func main() {
 	logger.Info("All jobs completed and srv shut down. Exiting.")
 }
 
+// logRetention reads the log stream limits, LOG_MAX_AGE as a duration and
+// LOG_MAX_BYTES as a byte count
+func logRetention() (time.Duration, int64, error) {
+	maxAge, err := envDuration("LOG_MAX_AGE", logstream.DefaultMaxAge)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	maxBytes, err := envInt("LOG_MAX_BYTES", logstream.DefaultMaxBytes)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return maxAge, maxBytes, nil
+}
+
+// logCacheConfig reads the limits of the in-memory log cache
+func logCacheConfig() (cache.Config, error) {
+	maxLines, err := envInt("LOG_CACHE_MAX_LINES", 20000)
+	if err != nil {
+		return cache.Config{}, err
+	}
+
+	maxRuns, err := envInt("LOG_CACHE_MAX_RUNS", 100)
+	if err != nil {
+		return cache.Config{}, err
+	}
+
+	ttl, err := envDuration("LOG_CACHE_TTL", time.Hour)
+	if err != nil {
+		return cache.Config{}, err
+	}
+
+	return cache.Config{
+		MaxItemsPerKey: int(maxLines),
+		MaxKeys:        int(maxRuns),
+		TTL:            ttl,
+	}, nil
+}
+
+// nextflowLaunchDir is where runs launched by the orchestrator get their
+// launch directory, NEXTFLOW_LAUNCH_DIR defaults to the launch directory in
+// dataDir
+func nextflowLaunchDir(dataDir string) (string, error) {
+	dir := os.Getenv("NEXTFLOW_LAUNCH_DIR")
+	if dir == "" {
+		dir = filepath.Join(dataDir, "launch")
+	}
+	return filepath.Abs(dir)
+}
+
+// localRunnerConfig reads the limits of the local executor, runs are placed
+// below LOCAL_RUNS_DIR which defaults to the runs directory in dataDir
+func localRunnerConfig(dataDir string) (local.Config, error) {
+	baseDir := os.Getenv("LOCAL_RUNS_DIR")
+	if baseDir == "" {
+		baseDir = filepath.Join(dataDir, "runs")
+	}
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return local.Config{}, err
+	}
+
+	maxCpus, err := envInt("LOCAL_MAX_CPUS", int64(runtime.NumCPU()))
+	if err != nil {
+		return local.Config{}, err
+	}
+
+	c := local.Config{
+		BaseDir:   baseDir,
+		MaxCpus:   int(maxCpus),
+		MaxMemory: os.Getenv("LOCAL_MAX_MEMORY"),
+	}
+	return c, c.Validate()
+}
+
+// hpcRunnerConfig reads the batch scheduler settings, HPC_BASE_DIR has to be
+// a directory shared with the cluster nodes
+func hpcRunnerConfig(scheduler hpc.Scheduler) (hpc.Config, error) {
+	pollInterval, err := envDuration("HPC_POLL_INTERVAL", 0)
+	if err != nil {
+		return hpc.Config{}, err
+	}
+
+	c := hpc.Config{
+		Scheduler:       scheduler,
+		NextflowBinPath: "nextflow",
+		SubmitBinPath:   os.Getenv("HPC_SUBMIT_BIN"),
+		CancelBinPath:   os.Getenv("HPC_CANCEL_BIN"),
+		StatusBinPath:   os.Getenv("HPC_STATUS_BIN"),
+		BaseDir:         os.Getenv("HPC_BASE_DIR"),
+		Queue:           os.Getenv("HPC_QUEUE"),
+		PollInterval:    pollInterval,
+	}
+	return c, c.Validate()
+}
+
+func k8sRunnerConfig(namespace string, logger *slog.Logger, nfService *nextflow.Service) k8s.Config {
+	serviceAccount := os.Getenv("K8S_SERVICE_ACCOUNT")
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+
+	return k8s.Config{
+		Logger:           logger,
+		Nextflow:         nfService,
+		Namespace:        namespace,
+		ServiceAccount:   serviceAccount,
+		StorageClaim:     os.Getenv("K8S_STORAGE_CLAIM"),
+		StorageMountPath: os.Getenv("K8S_STORAGE_MOUNT_PATH"),
+		APIServer:        os.Getenv("K8S_API_SERVER"),
+		Token:            os.Getenv("K8S_TOKEN"),
+		CAFile:           os.Getenv("K8S_CA_FILE"),
+	}
+}
+
+// queueLimits reads the run concurrency limits, MAX_RUNS_PER_EXECUTOR is a
+// comma separated list of executor=limit pairs. Zero or unset means unlimited.
+func queueLimits() (queue.Limits, error) {
+	maxRuns, err := envInt("MAX_RUNS", 0)
+	if err != nil {
+		return queue.Limits{}, err
+	}
+
+	maxRunsPerUser, err := envInt("MAX_RUNS_PER_USER", 0)
+	if err != nil {
+		return queue.Limits{}, err
+	}
+
+	perExecutor, err := envIntMap("MAX_RUNS_PER_EXECUTOR")
+	if err != nil {
+		return queue.Limits{}, err
+	}
+
+	return queue.Limits{
+		MaxRuns:            int(maxRuns),
+		MaxRunsPerExecutor: perExecutor,
+		MaxRunsPerUser:     int(maxRunsPerUser),
+	}, nil
+}
+
+// launchRetryPolicies reads the retry policy for transient launch failures,
+// LAUNCH_MAX_ATTEMPTS_PER_EXECUTOR is a comma separated list of
+// executor=attempts pairs overriding LAUNCH_MAX_ATTEMPTS.
+func launchRetryPolicies() (retry.Policies, error) {
+	maxAttempts, err := envInt("LAUNCH_MAX_ATTEMPTS", 3)
+	if err != nil {
+		return retry.Policies{}, err
+	}
+
+	backoff, err := envDuration("LAUNCH_RETRY_BACKOFF", 5*time.Second)
+	if err != nil {
+		return retry.Policies{}, err
+	}
+
+	maxBackoff, err := envDuration("LAUNCH_RETRY_MAX_BACKOFF", time.Minute)
+	if err != nil {
+		return retry.Policies{}, err
+	}
+
+	perExecutor, err := envIntMap("LAUNCH_MAX_ATTEMPTS_PER_EXECUTOR")
+	if err != nil {
+		return retry.Policies{}, err
+	}
+
+	policy := retry.Policy{
+		MaxAttempts: int(maxAttempts),
+		Backoff:     backoff,
+		MaxBackoff:  maxBackoff,
+	}
+
+	// float logs in before every submission, a failed login is usually an
+	// OpCenter that is briefly unavailable
+	floatPolicy := policy
+	floatPolicy.Retryable = retry.Matching(retry.Transient, "float login failed")
+
+	policies := retry.Policies{
+		Default:   policy,
+		Executors: map[string]retry.Policy{"float": floatPolicy},
+	}
+	for executor, attempts := range perExecutor {
+		p := policies.For(executor)
+		p.MaxAttempts = attempts
+		policies.Executors[executor] = p
+	}
+
+	return policies, nil
+}
+
+// trackActiveRuns gives the runs that survived a restart their queue slots
+func trackActiveRuns(ctx context.Context, runStore *runs.Store, runQueue *queue.Queue[runner.RunConfig]) error {
+	active, err := runStore.Active(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range active {
+		// queued runs wait for a slot, see Resolver.RequeueRuns
+		if run.State == model.RunStateQueued {
+			continue
+		}
+
+		entry := queue.Entry[runner.RunConfig]{
+			RunName:  run.RunName,
+			Executor: run.Executor,
+		}
+		if run.User != nil {
+			entry.User = *run.User
+		}
+		if run.Priority != nil {
+			entry.Priority = run.Priority.Rank()
+		}
+		runQueue.Track(entry)
+	}
+	return nil
+}
+
+// number of pipeline commits whose parameter schema is kept
+const schemaCacheSize = 256
+
+// remoteExecutors run jobs outside the worker which outlive a restart
+var remoteExecutors = map[string]bool{
+	"float":           true,
+	string(hpc.Slurm): true,
+	string(hpc.PBS):   true,
+}
+
+// runAlive reports whether a run recorded by a previous worker may still be running.
+// Jobs of remote executors live outside the worker and are followed again. Nothing
+// waits on the nextflow process of a local run after a restart, it would never
+// report finished and hold its queue slot, so it is stopped and the run failed.
+func runAlive(logger *slog.Logger) func(run model.Run) bool {
+	return func(run model.Run) bool {
+		// queued runs were never started or were preempted, they are queued
+		// again on startup
+		if run.State == model.RunStateQueued {
+			return true
+		}
+		if run.ProcessKey == "" {
+			return false
+		}
+		if remoteExecutors[run.Executor] {
+			return true
+		}
+
+		pid, err := strconv.Atoi(run.ProcessKey)
+		if err != nil || !runner.ProcessAlive(pid) {
+			return false
+		}
+
+		logger.Info("stopping nextflow process orphaned by worker restart", "run_name", run.RunName, "pid", pid)
+		go func() {
+			err := runner.GracefullyStopProcessByID(pid)
+			if err != nil && !errors.Is(err, runner.ErrAlreadyFinished) {
+				logger.Error("failed to stop orphaned nextflow process", "run_name", run.RunName, "pid", pid, "error", err)
+			}
+		}()
+		return false
+	}
+}
+
+// jobFollower follows a job of a remote executor until it ends
+type jobFollower interface {
+	Poll(runName string, jobID string, resumed bool)
+}
+
+// resumeRuns follows remote jobs that were submitted by a previous worker
+func resumeRuns(ctx context.Context, runStore *runs.Store, followers map[string]jobFollower) error {
+	active, err := runStore.Active(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range active {
+		follower, ok := followers[run.Executor]
+		if ok && run.ProcessKey != "" {
+			follower.Poll(run.RunName, run.ProcessKey, true)
+		}
+	}
+	return nil
+}
+
 // RunEmbeddedNatsServer - Nats Server + Client, to be replaced with a separate service later
-func RunEmbeddedNatsServer() (*nats.Conn, *server.Server, jetstream.JetStream, error) {
-	natsOpts := &server.Options{}
+func RunEmbeddedNatsServer(storeDir string) (*nats.Conn, *server.Server, jetstream.JetStream, error) {
+	natsOpts := &server.Options{
+		JetStream: true,
+		StoreDir:  storeDir,
+	}
 
 	ns, err := server.NewServer(natsOpts)
 	if err != nil {
@@ -129,7 +664,9 @@ func RunEmbeddedNatsServer() (*nats.Conn, *server.Server, jetstream.JetStream, e
 	return nc, ns, js, nil
 }
 
-func RunGraphQLServer(nc *nats.Conn, js jetstream.JetStream, logger *slog.Logger, nfService runner.Runner, floatService runner.Runner, wg *sync.WaitGroup, port string, logCache *cache.Cache[model.Log]) {
+func RunGraphQLServer(resolver *graph.Resolver, port string) {
+	logger := resolver.Logger
+
 	corsOpts := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowCredentials: true,
@@ -141,7 +678,7 @@ func RunGraphQLServer(nc *nats.Conn, js jetstream.JetStream, logger *slog.Logger
 	router.Use(auth.AuthMiddleware(logger))
 	router.Use(corsOpts.Handler)
 
-	srv := handler.New(gqlSchema(logger, nc, js, nfService, floatService, wg, logCache))
+	srv := handler.New(gqlSchema(resolver))
 	srv.AddTransport(transport.SSE{})
 	srv.AddTransport(transport.POST{})
 	srv.AddTransport(transport.Options{})
@@ -176,24 +713,16 @@ func RunGraphQLServer(nc *nats.Conn, js jetstream.JetStream, logger *slog.Logger
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("OK"))
 	})
+	router.With(auth.RequireToken).Get("/runs/{runName}/logs.txt", resolver.LogHistory.ServeText)
+	router.With(auth.RequireToken).Handle("/debug/vars", expvar.Handler())
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
 	log.Fatal(http.ListenAndServe(":"+port, router))
 }
 
-func gqlSchema(logger *slog.Logger, nc *nats.Conn, js jetstream.JetStream, nfService runner.Runner, floatService runner.Runner, wg *sync.WaitGroup, logCache *cache.Cache[model.Log]) graphql.ExecutableSchema {
-
+func gqlSchema(resolver *graph.Resolver) graphql.ExecutableSchema {
 	config := graph.Config{
-		Resolvers: &graph.Resolver{
-			NatsConn:     nc,
-			Logger:       logger,
-			NFService:    nfService,
-			FloatService: floatService,
-			Wg:           wg,
-			Nc:           nc,
-			Js:           js,
-			LogCache:     logCache,
-		},
+		Resolvers: resolver,
 	}
 	config.Directives.Authorized = auth.Authorized()
 	return graph.NewExecutableSchema(config)
@@ -1,5 +1,14 @@
 package model
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 func (p Parameter) String() []string {
 	if p.IsFlag {
 		return []string{p.Key}
@@ -16,3 +25,125 @@ func (r RunJobCommand) Args() []string {
 
 	return args
 }
+
+// RevisionParameter returns the revision given with the -r or -revision
+// parameter, empty when there is none
+func (r RunJobCommand) RevisionParameter() string {
+	for _, p := range r.Parameters {
+		if !p.IsFlag && (p.Key == "-r" || p.Key == "-revision") {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+func (r RunJobCommand) RunParameters() []*RunParameter {
+	params := make([]*RunParameter, 0, len(r.Parameters))
+	for _, p := range r.Parameters {
+		params = append(params, &RunParameter{
+			Key:    p.Key,
+			Value:  p.Value,
+			IsFlag: p.IsFlag,
+		})
+	}
+
+	return params
+}
+
+// RunParams returns the params given as a map or as YAML, nil when none
+// were given
+func (r RunJobCommand) RunParams() (map[string]interface{}, error) {
+	if r.ParamsYaml == nil || strings.TrimSpace(*r.ParamsYaml) == "" {
+		return r.Params, nil
+	}
+	if len(r.Params) > 0 {
+		return nil, errors.New("params and paramsYaml cannot be combined")
+	}
+
+	var params map[string]interface{}
+	err := yaml.Unmarshal([]byte(*r.ParamsYaml), &params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid paramsYaml: %w", err)
+	}
+
+	// maps with keys other than strings have no JSON representation
+	_, err = json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid paramsYaml: %w", err)
+	}
+
+	return params, nil
+}
+
+// RunPriority returns the requested priority, NORMAL when none was given
+func (r RunJobCommand) RunPriority() RunPriority {
+	if r.Priority == nil {
+		return RunPriorityNormal
+	}
+	return *r.Priority
+}
+
+// Rank orders priorities, runs of a higher rank are started first
+func (p RunPriority) Rank() int {
+	switch p {
+	case RunPriorityLow:
+		return 0
+	case RunPriorityHigh:
+		return 2
+	case RunPriorityCritical:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// Args returns the nextflow arguments of the run's parameters
+func (r Run) Args() []string {
+	args := make([]string, 0, len(r.Parameters))
+	for _, p := range r.Parameters {
+		args = append(args, Parameter{Key: p.Key, Value: p.Value, IsFlag: p.IsFlag}.String()...)
+	}
+
+	return args
+}
+
+// Command returns the run job command the schedule fires under the given
+// run name
+func (s Schedule) Command(runName string) RunJobCommand {
+	params := make([]*Parameter, 0, len(s.Parameters))
+	for _, p := range s.Parameters {
+		params = append(params, &Parameter{Key: p.Key, Value: p.Value, IsFlag: p.IsFlag})
+	}
+
+	return RunJobCommand{
+		RunName:     runName,
+		PipelineURL: s.PipelineURL,
+		Revision:    s.Revision,
+		Executor: &Executor{
+			Name:            s.Executor,
+			ComputeOverride: s.ComputeOverride,
+		},
+		Parameters: params,
+		Params:     s.Params,
+		User:       s.User,
+		Priority:   s.Priority,
+	}
+}
+
+// Template returns the launch template described by the input
+func (i LaunchTemplateInput) Template() LaunchTemplate {
+	params := make([]*RunParameter, 0, len(i.Parameters))
+	for _, p := range i.Parameters {
+		params = append(params, &RunParameter{Key: p.Key, Value: p.Value, IsFlag: p.IsFlag})
+	}
+
+	return LaunchTemplate{
+		Name:            i.Name,
+		PipelineURL:     i.PipelineURL,
+		Revision:        i.Revision,
+		Executor:        i.Executor.Name,
+		ComputeOverride: i.Executor.ComputeOverride,
+		Parameters:      params,
+		Params:          i.Params,
+	}
+}
@@ -2,46 +2,525 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+type ErrorLocation struct {
+	File   *string `json:"file,omitempty"`
+	Line   *int    `json:"line,omitempty"`
+	Column *int    `json:"column,omitempty"`
+}
+
 type Executor struct {
 	Name            string `json:"name"`
 	ComputeOverride string `json:"computeOverride"`
 }
 
+type ExecutorInfo struct {
+	Name      string `json:"name"`
+	CanStop   bool   `json:"canStop"`
+	CanResume bool   `json:"canResume"`
+	NeedsMock bool   `json:"needsMock"`
+}
+
+type LaunchAttempt struct {
+	Attempt   int      `json:"attempt"`
+	Phase     LogPhase `json:"phase"`
+	Error     *string  `json:"error,omitempty"`
+	Retried   bool     `json:"retried"`
+	Timestamp string   `json:"timestamp"`
+}
+
+type LaunchTemplate struct {
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	PipelineURL     string                 `json:"pipelineUrl"`
+	Revision        *string                `json:"revision,omitempty"`
+	Executor        string                 `json:"executor"`
+	ComputeOverride string                 `json:"computeOverride"`
+	Parameters      []*RunParameter        `json:"parameters"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+	CreatedAt       string                 `json:"createdAt"`
+	UpdatedAt       string                 `json:"updatedAt"`
+}
+
+type LaunchTemplateInput struct {
+	Name        string                 `json:"name"`
+	PipelineURL string                 `json:"pipelineUrl"`
+	Revision    *string                `json:"revision,omitempty"`
+	Executor    *Executor              `json:"executor"`
+	Parameters  []*Parameter           `json:"parameters"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+}
+
 type Log struct {
-	Message   string `json:"message"`
-	Timestamp string `json:"timestamp"`
+	Seq       int       `json:"seq"`
+	Message   string    `json:"message"`
+	Timestamp string    `json:"timestamp"`
+	Stream    LogStream `json:"stream"`
+	Level     LogLevel  `json:"level"`
+	Phase     LogPhase  `json:"phase"`
+}
+
+type LogPage struct {
+	Items []*Log `json:"items"`
+	Total int    `json:"total"`
 }
 
 type Mutation struct {
 }
 
+type PageInput struct {
+	Offset *int `json:"offset,omitempty"`
+	Limit  *int `json:"limit,omitempty"`
+}
+
 type Parameter struct {
 	Key    string `json:"key"`
 	Value  string `json:"value"`
 	IsFlag bool   `json:"isFlag"`
 }
 
+type ParameterError struct {
+	Field   string  `json:"field"`
+	Message string  `json:"message"`
+	Keyword *string `json:"keyword,omitempty"`
+}
+
+type PreviewError struct {
+	Message  string         `json:"message"`
+	Location *ErrorLocation `json:"location,omitempty"`
+}
+
 type Query struct {
 }
 
+type Run struct {
+	RunName         string                 `json:"runName"`
+	Executor        string                 `json:"executor"`
+	PipelineURL     string                 `json:"pipelineUrl"`
+	Revision        *string                `json:"revision,omitempty"`
+	CommitSha       *string                `json:"commitSha,omitempty"`
+	Parameters      []*RunParameter        `json:"parameters"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+	ProcessKey      string                 `json:"processKey"`
+	User            *string                `json:"user,omitempty"`
+	Priority        *RunPriority           `json:"priority,omitempty"`
+	ComputeOverride *string                `json:"computeOverride,omitempty"`
+	Attempt         int                    `json:"attempt"`
+	Attempts        []*RunAttempt          `json:"attempts"`
+	LaunchAttempts  []*LaunchAttempt       `json:"launchAttempts"`
+	State           RunState               `json:"state"`
+	CancelRequested bool                   `json:"cancelRequested"`
+	QueuePosition   *int                   `json:"queuePosition,omitempty"`
+	ExitCode        *int                   `json:"exitCode,omitempty"`
+	Signal          *string                `json:"signal,omitempty"`
+	DurationSeconds *float64               `json:"durationSeconds,omitempty"`
+	StderrTail      []string               `json:"stderrTail,omitempty"`
+	NextflowLog     *string                `json:"nextflowLog,omitempty"`
+	Error           *string                `json:"error,omitempty"`
+	CreatedAt       string                 `json:"createdAt"`
+	UpdatedAt       string                 `json:"updatedAt"`
+	StartedAt       *string                `json:"startedAt,omitempty"`
+	FinishedAt      *string                `json:"finishedAt,omitempty"`
+}
+
+type RunAttempt struct {
+	Attempt     int      `json:"attempt"`
+	ProcessKey  string   `json:"processKey"`
+	SessionID   *string  `json:"sessionId,omitempty"`
+	State       RunState `json:"state"`
+	ExitCode    *int     `json:"exitCode,omitempty"`
+	Signal      *string  `json:"signal,omitempty"`
+	Error       *string  `json:"error,omitempty"`
+	StartedAt   *string  `json:"startedAt,omitempty"`
+	FinishedAt  *string  `json:"finishedAt,omitempty"`
+	NextflowLog *string  `json:"nextflowLog,omitempty"`
+}
+
+type RunFilter struct {
+	State       *RunState `json:"state,omitempty"`
+	Executor    *string   `json:"executor,omitempty"`
+	PipelineURL *string   `json:"pipelineUrl,omitempty"`
+}
+
 type RunJobCommand struct {
-	RunName     string       `json:"runName"`
-	PipelineURL string       `json:"pipelineUrl"`
-	Executor    *Executor    `json:"executor"`
-	Parameters  []*Parameter `json:"parameters"`
+	RunName     string                 `json:"runName"`
+	PipelineURL string                 `json:"pipelineUrl"`
+	Revision    *string                `json:"revision,omitempty"`
+	Executor    *Executor              `json:"executor"`
+	Parameters  []*Parameter           `json:"parameters"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+	ParamsYaml  *string                `json:"paramsYaml,omitempty"`
+	User        *string                `json:"user,omitempty"`
+	Priority    *RunPriority           `json:"priority,omitempty"`
 }
 
 type RunJobResponse struct {
-	Status     bool   `json:"status"`
-	ProcessKey string `json:"processKey"`
-	Executor   string `json:"executor"`
-	RunName    string `json:"runName"`
+	Status        bool     `json:"status"`
+	ProcessKey    string   `json:"processKey"`
+	Executor      string   `json:"executor"`
+	RunName       string   `json:"runName"`
+	State         RunState `json:"state"`
+	QueuePosition *int     `json:"queuePosition,omitempty"`
+	CommitSha     *string  `json:"commitSha,omitempty"`
+}
+
+type RunPage struct {
+	Items []*Run `json:"items"`
+	Total int    `json:"total"`
+}
+
+type RunParameter struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	IsFlag bool   `json:"isFlag"`
+}
+
+type RunPreview struct {
+	Success    bool           `json:"success"`
+	Processes  []string       `json:"processes"`
+	Warnings   []string       `json:"warnings"`
+	Error      *PreviewError  `json:"error,omitempty"`
+	Output     string         `json:"output"`
+	Parameters *RunValidation `json:"parameters"`
+}
+
+type RunStatus struct {
+	RunName         string   `json:"runName"`
+	State           RunState `json:"state"`
+	ProcessKey      *string  `json:"processKey,omitempty"`
+	ExitCode        *int     `json:"exitCode,omitempty"`
+	Signal          *string  `json:"signal,omitempty"`
+	DurationSeconds *float64 `json:"durationSeconds,omitempty"`
+	StderrTail      []string `json:"stderrTail"`
+	Error           *string  `json:"error,omitempty"`
+	FinishedAt      *string  `json:"finishedAt,omitempty"`
+}
+
+type RunValidation struct {
+	Valid       bool              `json:"valid"`
+	SchemaFound bool              `json:"schemaFound"`
+	Errors      []*ParameterError `json:"errors"`
+	Warnings    []string          `json:"warnings"`
+}
+
+type Schedule struct {
+	Name            string                 `json:"name"`
+	Cron            string                 `json:"cron"`
+	Overlap         ScheduleOverlap        `json:"overlap"`
+	Paused          bool                   `json:"paused"`
+	RunNamePrefix   string                 `json:"runNamePrefix"`
+	PipelineURL     string                 `json:"pipelineUrl"`
+	Revision        *string                `json:"revision,omitempty"`
+	Executor        string                 `json:"executor"`
+	ComputeOverride string                 `json:"computeOverride"`
+	Parameters      []*RunParameter        `json:"parameters"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+	User            *string                `json:"user,omitempty"`
+	Priority        *RunPriority           `json:"priority,omitempty"`
+	NextFireAt      *string                `json:"nextFireAt,omitempty"`
+	LastFiredAt     *string                `json:"lastFiredAt,omitempty"`
+	LastRunName     *string                `json:"lastRunName,omitempty"`
+	LastError       *string                `json:"lastError,omitempty"`
+	PendingFire     bool                   `json:"pendingFire"`
+	CreatedAt       string                 `json:"createdAt"`
+	UpdatedAt       string                 `json:"updatedAt"`
+}
+
+type ScheduleCommand struct {
+	Name     string           `json:"name"`
+	Cron     string           `json:"cron"`
+	Overlap  *ScheduleOverlap `json:"overlap,omitempty"`
+	Template *RunJobCommand   `json:"template"`
 }
 
 type Subscription struct {
 }
 
+type TemplateOverrides struct {
+	RunName         string                 `json:"runName"`
+	Revision        *string                `json:"revision,omitempty"`
+	Parameters      []*Parameter           `json:"parameters,omitempty"`
+	Params          map[string]interface{} `json:"params,omitempty"`
+	Executor        *string                `json:"executor,omitempty"`
+	ComputeOverride *string                `json:"computeOverride,omitempty"`
+	User            *string                `json:"user,omitempty"`
+	Priority        *RunPriority           `json:"priority,omitempty"`
+}
+
 type TerminateJobCommand struct {
 	ProcessKey string `json:"processKey"`
 	Executor   string `json:"executor"`
 }
+
+type LogLevel string
+
+const (
+	LogLevelDebug LogLevel = "DEBUG"
+	LogLevelInfo  LogLevel = "INFO"
+	LogLevelWarn  LogLevel = "WARN"
+	LogLevelError LogLevel = "ERROR"
+)
+
+var AllLogLevel = []LogLevel{
+	LogLevelDebug,
+	LogLevelInfo,
+	LogLevelWarn,
+	LogLevelError,
+}
+
+func (e LogLevel) IsValid() bool {
+	switch e {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+		return true
+	}
+	return false
+}
+
+func (e LogLevel) String() string {
+	return string(e)
+}
+
+func (e *LogLevel) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LogLevel(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LogLevel", str)
+	}
+	return nil
+}
+
+func (e LogLevel) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type LogPhase string
+
+const (
+	LogPhaseValidation LogPhase = "VALIDATION"
+	LogPhaseRun        LogPhase = "RUN"
+)
+
+var AllLogPhase = []LogPhase{
+	LogPhaseValidation,
+	LogPhaseRun,
+}
+
+func (e LogPhase) IsValid() bool {
+	switch e {
+	case LogPhaseValidation, LogPhaseRun:
+		return true
+	}
+	return false
+}
+
+func (e LogPhase) String() string {
+	return string(e)
+}
+
+func (e *LogPhase) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LogPhase(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LogPhase", str)
+	}
+	return nil
+}
+
+func (e LogPhase) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type LogStream string
+
+const (
+	LogStreamStdout LogStream = "STDOUT"
+	LogStreamStderr LogStream = "STDERR"
+	LogStreamSystem LogStream = "SYSTEM"
+	LogStreamMock   LogStream = "MOCK"
+)
+
+var AllLogStream = []LogStream{
+	LogStreamStdout,
+	LogStreamStderr,
+	LogStreamSystem,
+	LogStreamMock,
+}
+
+func (e LogStream) IsValid() bool {
+	switch e {
+	case LogStreamStdout, LogStreamStderr, LogStreamSystem, LogStreamMock:
+		return true
+	}
+	return false
+}
+
+func (e LogStream) String() string {
+	return string(e)
+}
+
+func (e *LogStream) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LogStream(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LogStream", str)
+	}
+	return nil
+}
+
+func (e LogStream) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RunPriority string
+
+const (
+	RunPriorityLow      RunPriority = "LOW"
+	RunPriorityNormal   RunPriority = "NORMAL"
+	RunPriorityHigh     RunPriority = "HIGH"
+	RunPriorityCritical RunPriority = "CRITICAL"
+)
+
+var AllRunPriority = []RunPriority{
+	RunPriorityLow,
+	RunPriorityNormal,
+	RunPriorityHigh,
+	RunPriorityCritical,
+}
+
+func (e RunPriority) IsValid() bool {
+	switch e {
+	case RunPriorityLow, RunPriorityNormal, RunPriorityHigh, RunPriorityCritical:
+		return true
+	}
+	return false
+}
+
+func (e RunPriority) String() string {
+	return string(e)
+}
+
+func (e *RunPriority) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RunPriority(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RunPriority", str)
+	}
+	return nil
+}
+
+func (e RunPriority) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type RunState string
+
+const (
+	RunStatePending    RunState = "PENDING"
+	RunStateQueued     RunState = "QUEUED"
+	RunStateValidating RunState = "VALIDATING"
+	RunStateRunning    RunState = "RUNNING"
+	RunStateSucceeded  RunState = "SUCCEEDED"
+	RunStateFailed     RunState = "FAILED"
+	RunStateCancelled  RunState = "CANCELLED"
+)
+
+var AllRunState = []RunState{
+	RunStatePending,
+	RunStateQueued,
+	RunStateValidating,
+	RunStateRunning,
+	RunStateSucceeded,
+	RunStateFailed,
+	RunStateCancelled,
+}
+
+func (e RunState) IsValid() bool {
+	switch e {
+	case RunStatePending, RunStateQueued, RunStateValidating, RunStateRunning, RunStateSucceeded, RunStateFailed, RunStateCancelled:
+		return true
+	}
+	return false
+}
+
+func (e RunState) String() string {
+	return string(e)
+}
+
+func (e *RunState) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = RunState(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid RunState", str)
+	}
+	return nil
+}
+
+func (e RunState) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ScheduleOverlap string
+
+const (
+	ScheduleOverlapSkip  ScheduleOverlap = "SKIP"
+	ScheduleOverlapQueue ScheduleOverlap = "QUEUE"
+)
+
+var AllScheduleOverlap = []ScheduleOverlap{
+	ScheduleOverlapSkip,
+	ScheduleOverlapQueue,
+}
+
+func (e ScheduleOverlap) IsValid() bool {
+	switch e {
+	case ScheduleOverlapSkip, ScheduleOverlapQueue:
+		return true
+	}
+	return false
+}
+
+func (e ScheduleOverlap) String() string {
+	return string(e)
+}
+
+func (e *ScheduleOverlap) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ScheduleOverlap(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ScheduleOverlap", str)
+	}
+	return nil
+}
+
+func (e ScheduleOverlap) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -4,9 +4,15 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"log/slog"
-	"nf-shard-orchestrator/graph/model"
-	"nf-shard-orchestrator/pkg/cache"
+	"nf-shard-orchestrator/pkg/pipelineschema"
+	"nf-shard-orchestrator/pkg/queue"
+	"nf-shard-orchestrator/pkg/retry"
+	"nf-shard-orchestrator/pkg/revision"
 	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runs"
+	"nf-shard-orchestrator/pkg/schedules"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"nf-shard-orchestrator/pkg/templates"
 	"sync"
 )
 
@@ -15,12 +21,32 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	NatsConn     *nats.Conn
-	Logger       *slog.Logger
-	NFService    runner.Runner
-	FloatService runner.Runner
-	Wg           *sync.WaitGroup
-	Nc           *nats.Conn
-	Js           jetstream.JetStream
-	LogCache     *cache.Cache[model.Log]
+	NatsConn        *nats.Conn
+	Logger          *slog.Logger
+	Runners         *runner.Registry
+	NextflowBinPath string
+	Wg              *sync.WaitGroup
+	Nc              *nats.Conn
+	Js              jetstream.JetStream
+	RunStore        *runs.Store
+	LogHistory      *logstream.History
+	RunQueue        *queue.Queue[runner.RunConfig]
+	// Preemption lets critical runs stop lower priority resumable runs
+	// when they cannot get a slot
+	Preemption bool
+	// Retry is the policy per executor for transient validation and
+	// launch failures
+	Retry         retry.Policies
+	ScheduleStore *schedules.Store
+	Scheduler     *schedules.Scheduler
+	TemplateStore *templates.Store
+	// Revisions resolves pipeline revisions to commits, nil launches runs
+	// unpinned
+	Revisions *revision.Resolver
+	// Schemas fetches the parameter schema runs are validated against, nil
+	// skips the validation
+	Schemas *pipelineschema.Fetcher
+	// Previews bounds the nextflow previews run at once, a preview holds a
+	// slot by sending to it. nil leaves previews unbounded.
+	Previews chan struct{}
 }
@@ -0,0 +1,674 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/cache"
+	"nf-shard-orchestrator/pkg/natstest"
+	"nf-shard-orchestrator/pkg/pipelineschema"
+	"nf-shard-orchestrator/pkg/queue"
+	"nf-shard-orchestrator/pkg/revision"
+	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runs"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeRunner records the runs it executes, runs finish when finish is
+// called for them or right away when autoFinish is set
+type fakeRunner struct {
+	nc         *nats.Conn
+	baseDir    string
+	autoFinish bool
+
+	mu       sync.Mutex
+	executed map[string][]runner.RunConfig
+	stopped  []string
+	// stopErr is returned by Stop, alive by Alive
+	stopErr error
+	alive   bool
+	// onStop is called with the name of each stopped run
+	onStop func(runName string)
+}
+
+func (f *fakeRunner) Execute(ctx context.Context, run runner.RunConfig, runName string) (string, error) {
+	f.mu.Lock()
+	f.executed[runName] = append(f.executed[runName], run)
+	processKey := fmt.Sprintf("%s-%d", runName, len(f.executed[runName]))
+	f.mu.Unlock()
+
+	if f.autoFinish {
+		go f.finish(runName, model.RunStateSucceeded)
+	}
+	return processKey, nil
+}
+
+// finish reports the latest process of a run finished
+func (f *fakeRunner) finish(runName string, state model.RunState) {
+	f.mu.Lock()
+	processKey := fmt.Sprintf("%s-%d", runName, len(f.executed[runName]))
+	f.mu.Unlock()
+
+	status := model.RunStatus{RunName: runName, State: state, ProcessKey: &processKey, StderrTail: []string{}}
+	_ = runs.PublishFinished(f.nc, status)
+}
+
+func (f *fakeRunner) Stop(c runner.StopConfig) error {
+	f.mu.Lock()
+	f.stopped = append(f.stopped, c.RunName)
+	onStop := f.onStop
+	f.mu.Unlock()
+
+	if onStop != nil {
+		onStop(c.RunName)
+	}
+	return f.stopErr
+}
+
+func (f *fakeRunner) Alive(ctx context.Context, processKey string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.alive, nil
+}
+
+func (f *fakeRunner) BinPath() string {
+	return "nextflow"
+}
+
+func (f *fakeRunner) LaunchDir(runName string) string {
+	return filepath.Join(f.baseDir, runName)
+}
+
+// stoppedRuns returns the runs Stop was called for
+func (f *fakeRunner) stoppedRuns() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string{}, f.stopped...)
+}
+
+// runs returns the runs executed under runName
+func (f *fakeRunner) runs(runName string) []runner.RunConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]runner.RunConfig{}, f.executed[runName]...)
+}
+
+func newTestResolver(t *testing.T, limits queue.Limits) (*Resolver, *fakeRunner) {
+	t.Helper()
+
+	nc, js := natstest.Start(t)
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	_, err := logstream.CreateStream(ctx, js, time.Hour, logstream.DefaultMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runStore, err := runs.NewStore(ctx, nc, js, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeRunner{nc: nc, baseDir: t.TempDir(), executed: make(map[string][]runner.RunConfig)}
+	runners := runner.NewRegistry()
+	err = runners.Register(fake, runner.Capabilities{CanStop: true, CanResume: true}, "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Resolver{
+		Logger:          logger,
+		Runners:         runners,
+		NextflowBinPath: "nextflow",
+		Wg:              &sync.WaitGroup{},
+		Nc:              nc,
+		Js:              js,
+		RunStore:        runStore,
+		RunQueue:        queue.New[runner.RunConfig](limits),
+	}
+
+	for _, subscribe := range []func() (*nats.Subscription, error){runStore.Watch, r.WatchQueue} {
+		sub, err := subscribe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = sub.Unsubscribe() })
+	}
+
+	return r, fake
+}
+
+func command(runName string, args ...string) model.RunJobCommand {
+	params := make([]*model.Parameter, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		params = append(params, &model.Parameter{Key: args[i], Value: args[i+1]})
+	}
+	return model.RunJobCommand{
+		RunName:     runName,
+		PipelineURL: "nf-core/demo",
+		Executor:    &model.Executor{Name: "fake"},
+		Parameters:  params,
+	}
+}
+
+// waitForState waits until the run reaches state
+func waitForState(t *testing.T, r *Resolver, runName string, state model.RunState) *model.Run {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		run, err := r.RunStore.Get(context.Background(), runName)
+		if err != nil && !errors.Is(err, runs.ErrNotFound) {
+			t.Fatal(err)
+		}
+		if err == nil && run.State == state {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %s did not reach %s, got %+v", runName, state, run)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubmitQueuedRunsFinish(t *testing.T) {
+	r, fake := newTestResolver(t, queue.Limits{MaxRuns: 1})
+	fake.autoFinish = true
+
+	// slots are released while runs are submitted, a run admitted before
+	// it was recorded as queued must still finish and free its slot
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.runJob(context.Background(), command(fmt.Sprintf("run-%d", i)))
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		waitForState(t, r, fmt.Sprintf("run-%d", i), model.RunStateSucceeded)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.RunQueue.Stats() != (queue.Stats{}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue = %+v, want empty", r.RunQueue.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRequeueRuns(t *testing.T) {
+	r, fake := newTestResolver(t, queue.Limits{MaxRuns: 1})
+	ctx := context.Background()
+
+	for _, runName := range []string{"run-a", "run-b", "run-c"} {
+		_, err := r.runJob(ctx, command(runName))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForState(t, r, "run-a", model.RunStateRunning)
+	waitForState(t, r, "run-c", model.RunStateQueued)
+
+	// a new worker starts with an empty queue that only knows run-a
+	r.RunQueue = queue.New[runner.RunConfig](queue.Limits{MaxRuns: 1})
+	r.RunQueue.Track(queue.Entry[runner.RunConfig]{RunName: "run-a", Executor: "fake"})
+
+	err := r.RequeueRuns(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.RunQueue.Position("run-b"); got != 1 {
+		t.Errorf("position of run-b = %d, want 1", got)
+	}
+	if got := r.RunQueue.Position("run-c"); got != 2 {
+		t.Errorf("position of run-c = %d, want 2", got)
+	}
+
+	fake.finish("run-a", model.RunStateSucceeded)
+	run := waitForState(t, r, "run-b", model.RunStateRunning)
+	if run.ProcessKey != "run-b-1" {
+		t.Errorf("process key = %q, want run-b-1", run.ProcessKey)
+	}
+	if got := fake.runs("run-b")[0].Args; !slices.Contains(got, "run-b") {
+		t.Errorf("args = %v, want run name run-b", got)
+	}
+	if got := len(fake.runs("run-c")); got != 0 {
+		t.Errorf("run-c executed %d times, want 0", got)
+	}
+}
+
+func TestPreempt(t *testing.T) {
+	tests := []struct {
+		name    string
+		stopErr error
+		alive   bool
+		// preempted is whether the low priority run gives up its slot
+		preempted bool
+	}{
+		{name: "stopped", preempted: true},
+		{name: "already finished", stopErr: runner.ErrAlreadyFinished, preempted: true},
+		{name: "stop failed", stopErr: errors.New("permission denied"), alive: true},
+		{name: "gone after stop failed", stopErr: errors.New("waitid: no child processes"), preempted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, fake := newTestResolver(t, queue.Limits{MaxRuns: 1})
+			r.Preemption = true
+			fake.stopErr = tt.stopErr
+			fake.alive = tt.alive
+			ctx := context.Background()
+
+			_, err := r.runJob(ctx, command("low-run"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitForState(t, r, "low-run", model.RunStateRunning)
+
+			critical := command("critical-run")
+			priority := model.RunPriorityCritical
+			critical.Priority = &priority
+			_, err = r.runJob(ctx, critical)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.preempted {
+				deadline := time.Now().Add(5 * time.Second)
+				for len(fake.stoppedRuns()) == 0 {
+					if time.Now().After(deadline) {
+						t.Fatal("low-run was not stopped")
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				run := waitForState(t, r, "low-run", model.RunStateRunning)
+				if run.ProcessKey != "low-run-1" || run.Attempt != 1 {
+					t.Errorf("run = %+v, want attempt 1 with process low-run-1", run)
+				}
+				waitForState(t, r, "critical-run", model.RunStateQueued)
+				return
+			}
+
+			waitForState(t, r, "critical-run", model.RunStateRunning)
+			run := waitForState(t, r, "low-run", model.RunStateQueued)
+			if run.Attempt != 2 {
+				t.Errorf("attempt = %d, want 2", run.Attempt)
+			}
+
+			// the resumed attempt starts once the critical run finished
+			fake.finish("critical-run", model.RunStateSucceeded)
+			waitForState(t, r, "low-run", model.RunStateRunning)
+			attempts := fake.runs("low-run")
+			if len(attempts) != 2 {
+				t.Fatalf("low-run executed %d times, want 2", len(attempts))
+			}
+			args := strings.Join(attempts[1].Args, " ")
+			for _, want := range []string{"-name low-run-2", "-resume low-run"} {
+				if !strings.Contains(args, want) {
+					t.Errorf("args = %q, want %q", args, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCancelRun(t *testing.T) {
+	r, fake := newTestResolver(t, queue.Limits{})
+	ctx := context.Background()
+	mutation := &mutationResolver{r}
+
+	for _, runName := range []string{"cancel-run", "stuck-run"} {
+		_, err := r.runJob(ctx, command(runName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitForState(t, r, runName, model.RunStateRunning)
+	}
+
+	// the stopped process reports it failed before the run is cancelled
+	fake.onStop = func(runName string) {
+		fake.finish(runName, model.RunStateFailed)
+		waitForState(t, r, runName, model.RunStateCancelled)
+	}
+	cancelled, err := mutation.CancelRun(ctx, "cancel-run")
+	if err != nil || !cancelled {
+		t.Fatalf("CancelRun() = %v, %v, want true", cancelled, err)
+	}
+	run := waitForState(t, r, "cancel-run", model.RunStateCancelled)
+	if !run.CancelRequested {
+		t.Errorf("run = %+v, want cancel requested", run)
+	}
+
+	// a run that could not be stopped keeps running
+	fake.onStop = nil
+	fake.stopErr = errors.New("permission denied")
+	cancelled, err = mutation.CancelRun(ctx, "stuck-run")
+	if err == nil || cancelled {
+		t.Fatalf("CancelRun() = %v, %v, want error", cancelled, err)
+	}
+	fake.finish("stuck-run", model.RunStateSucceeded)
+	run = waitForState(t, r, "stuck-run", model.RunStateSucceeded)
+	if run.CancelRequested {
+		t.Errorf("run = %+v, want cancel withdrawn", run)
+	}
+}
+
+func TestResumeRun(t *testing.T) {
+	r, fake := newTestResolver(t, queue.Limits{})
+	ctx := context.Background()
+	mutation := &mutationResolver{r}
+
+	_, err := r.runJob(ctx, command("resume-run", "--input", "a.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, r, "resume-run", model.RunStateRunning)
+
+	_, err = mutation.ResumeRun(ctx, "resume-run")
+	if err == nil {
+		t.Fatal("expected running run not to be resumed")
+	}
+
+	// nextflow records the session of the first attempt in its history
+	history := filepath.Join(fake.LaunchDir("resume-run"), ".nextflow")
+	err = os.MkdirAll(history, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := "4dc49c1b-5bb4-4ea9-b3e4-8b8f5c8e4d2a"
+	line := "2024-05-01 10:00:00\t1m 2s\tresume-run\tERR\t1a2b3c4d5e\t" + session + "\tnextflow run x -name resume-run\n"
+	err = os.WriteFile(filepath.Join(history, "history"), []byte(line), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for attempt := 2; attempt <= 3; attempt++ {
+		fake.finish("resume-run", model.RunStateFailed)
+		waitForState(t, r, "resume-run", model.RunStateFailed)
+
+		_, err = mutation.ResumeRun(ctx, "resume-run")
+		if err != nil {
+			t.Fatal(err)
+		}
+		run := waitForState(t, r, "resume-run", model.RunStateRunning)
+		if run.Attempt != attempt {
+			t.Errorf("attempt = %d, want %d", run.Attempt, attempt)
+		}
+
+		executed := fake.runs("resume-run")
+		got := executed[len(executed)-1].Args
+		// attempt 3 resumes by run name, attempt 2 is not in the history
+		resume := session
+		if attempt == 3 {
+			resume = "resume-run-2"
+		}
+		want := []string{"--input", "a.csv", "-resume", resume, "-name", fmt.Sprintf("resume-run-%d", attempt)}
+		if !slices.Equal(got, want) {
+			t.Errorf("attempt %d args = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// gitPipeline creates a pipeline repository whose main branch requires the
+// input param and whose dev branch also requires outdir. It returns the
+// pipeline URL and the commits of both branches.
+func gitPipeline(t *testing.T) (url string, main string, dev string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	writeSchema := func(required string) {
+		schema := `{"type": "object", "required": [` + required + `], "properties": {"input": {"type": "string"}, "outdir": {"type": "string"}}}`
+		err := os.WriteFile(filepath.Join(dir, pipelineschema.FileName), []byte(schema), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		git(t, dir, "add", pipelineschema.FileName)
+		git(t, dir, "commit", "-q", "-m", "schema")
+	}
+
+	git(t, dir, "init", "-q", "-b", "main")
+	writeSchema(`"input"`)
+	main = git(t, dir, "rev-parse", "HEAD")
+	git(t, dir, "checkout", "-q", "-b", "dev")
+	writeSchema(`"input", "outdir"`)
+	dev = git(t, dir, "rev-parse", "HEAD")
+	git(t, dir, "checkout", "-q", "main")
+
+	return "file://" + filepath.ToSlash(dir), main, dev
+}
+
+func TestRunJobRevisionParameter(t *testing.T) {
+	url, main, dev := gitPipeline(t)
+	r, fake := newTestResolver(t, queue.Limits{})
+	r.Revisions = &revision.Resolver{GitBinPath: "git"}
+	r.Schemas = &pipelineschema.Fetcher{GitBinPath: "git"}
+	ctx := context.Background()
+
+	input := command("dev-run", "--input", "a.csv", "--outdir", "out", "-r", "dev")
+	input.PipelineURL = url
+	_, err := r.runJob(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := waitForState(t, r, "dev-run", model.RunStateRunning)
+	if run.Revision == nil || *run.Revision != "dev" {
+		t.Errorf("revision = %v, want dev", run.Revision)
+	}
+	if run.CommitSha == nil || *run.CommitSha != dev {
+		t.Errorf("commit = %v, want %s", run.CommitSha, dev)
+	}
+	executed := fake.runs("dev-run")[0]
+	if executed.Revision != dev || slices.Contains(executed.Args, "-r") {
+		t.Errorf("executed revision %q with args %v, want %s without -r", executed.Revision, executed.Args, dev)
+	}
+
+	// outdir is only required on the dev branch
+	input = command("invalid-run", "--input", "a.csv", "-r", "dev")
+	input.PipelineURL = url
+	_, err = r.runJob(ctx, input)
+	if err == nil || !strings.Contains(err.Error(), "outdir") {
+		t.Errorf("expected outdir to be required on dev, got %v", err)
+	}
+
+	input = command("main-run", "--input", "a.csv")
+	input.PipelineURL = url
+	_, err = r.runJob(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run = waitForState(t, r, "main-run", model.RunStateRunning)
+	if run.CommitSha == nil || *run.CommitSha != main {
+		t.Errorf("commit = %v, want %s", run.CommitSha, main)
+	}
+
+	input = command("conflicting-run", "-r", "dev")
+	input.PipelineURL = url
+	rev := "main"
+	input.Revision = &rev
+	_, err = r.runJob(ctx, input)
+	if err == nil {
+		t.Error("expected conflicting revisions to be rejected")
+	}
+}
+
+func TestValidateRun(t *testing.T) {
+	url, _, _ := gitPipeline(t)
+	r, _ := newTestResolver(t, queue.Limits{})
+	r.Revisions = &revision.Resolver{GitBinPath: "git"}
+	r.Schemas = &pipelineschema.Fetcher{GitBinPath: "git", Cache: cache.NewCache[[]byte](cache.Config{MaxItemsPerKey: 1})}
+	query := &queryResolver{r}
+
+	tests := []struct {
+		name     string
+		args     []string
+		valid    bool
+		warnings int
+	}{
+		{name: "default branch", args: []string{"--input", "a.csv"}, valid: true},
+		{name: "missing input", args: []string{"--outdir", "out"}, valid: false},
+		{name: "dev branch", args: []string{"--input", "a.csv", "-r", "dev"}, valid: false},
+		{name: "dev branch with outdir", args: []string{"--input", "a.csv", "--outdir", "out", "-revision", "dev"}, valid: true},
+		{name: "params file", args: []string{"-params-file", "params.json"}, valid: true, warnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := command("validated-run", tt.args...)
+			input.PipelineURL = url
+
+			validation, err := query.ValidateRun(context.Background(), input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if validation.Valid != tt.valid || len(validation.Warnings) != tt.warnings {
+				t.Errorf("validation = %+v, want valid %v with %d warnings", validation, tt.valid, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestPreviewRun(t *testing.T) {
+	r, _ := newTestResolver(t, queue.Limits{})
+	r.NextflowBinPath = filepath.Join(t.TempDir(), "nextflow")
+	script := "#!/bin/bash\necho 'WARN: Access to undefined parameter `genome`'\necho '[-        ] process > DEMO:FASTQC -'\n"
+	err := os.WriteFile(r.NextflowBinPath, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Previews = make(chan struct{}, 1)
+	mutation := &mutationResolver{r}
+
+	// a preview holds the only slot
+	r.Previews <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = mutation.ValidateRun(ctx, command("preview-run"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to wait for a preview slot, got %v", err)
+	}
+	<-r.Previews
+
+	preview, err := mutation.ValidateRun(context.Background(), command("preview-run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !preview.Success || !slices.Equal(preview.Processes, []string{"DEMO:FASTQC"}) || len(preview.Warnings) != 1 {
+		t.Errorf("preview = %+v, want DEMO:FASTQC with one warning", preview)
+	}
+	if len(r.Previews) != 0 {
+		t.Error("expected the preview to release its slot")
+	}
+}
+
+func TestCaptureNextflowLog(t *testing.T) {
+	r, fake := newTestResolver(t, queue.Limits{})
+	ctx := context.Background()
+
+	sub, err := r.CaptureLogs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sub.Unsubscribe() })
+
+	// waitForLog finishes the current attempt and waits for its log
+	waitForLog := func(want string) *model.Run {
+		t.Helper()
+
+		fake.finish("logged-run", model.RunStateFailed)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			run, err := r.RunStore.Get(ctx, "logged-run")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.NextflowLog != nil && strings.HasSuffix(*run.NextflowLog, want) {
+				return run
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("nextflow log of %s = %v, want it to end with %q", run.RunName, run.NextflowLog, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	_, err = r.runJob(ctx, command("logged-run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, r, "logged-run", model.RunStateRunning)
+
+	launchDir := fake.LaunchDir("logged-run")
+	err = os.MkdirAll(launchDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the end of a long log is kept
+	long := strings.Repeat("DEBUG nextflow is busy\n", nextflowLogMaxBytes/10) + "ERROR ~ first attempt failed\n"
+	err = os.WriteFile(runner.LogFile(launchDir, "logged-run"), []byte(long), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := waitForLog("ERROR ~ first attempt failed\n")
+	if len(*run.NextflowLog) > nextflowLogMaxBytes {
+		t.Errorf("kept %d bytes of the log, want at most %d", len(*run.NextflowLog), nextflowLogMaxBytes)
+	}
+
+	_, err = (&mutationResolver{r}).ResumeRun(ctx, "logged-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, r, "logged-run", model.RunStateRunning)
+	err = os.WriteFile(runner.LogFile(launchDir, "logged-run-2"), []byte("ERROR ~ second attempt failed\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run = waitForLog("ERROR ~ second attempt failed\n")
+	if *run.NextflowLog != "ERROR ~ second attempt failed\n" {
+		t.Errorf("nextflow log = %q, want the log of the second attempt", *run.NextflowLog)
+	}
+	if len(run.Attempts) != 1 || run.Attempts[0].NextflowLog == nil ||
+		!strings.HasSuffix(*run.Attempts[0].NextflowLog, "ERROR ~ first attempt failed\n") {
+		t.Errorf("attempts = %+v, want the first attempt with its log", run.Attempts)
+	}
+}
@@ -0,0 +1,709 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/queue"
+	"nf-shard-orchestrator/pkg/retry"
+	"nf-shard-orchestrator/pkg/revision"
+	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runs"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// end of the nextflow log kept on the record of a run attempt
+const nextflowLogMaxBytes = 64 << 10
+
+// failRun records a launch failure. It uses its own context so the record
+// is written even when the request context has been cancelled.
+func (r *Resolver) failRun(runName string, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.RunStore.Fail(ctx, runName, cause)
+	if err != nil {
+		r.Logger.Error("failed to record run failure", "run_name", runName, "error", err)
+	}
+}
+
+// cancelRun moves a run to CANCELLED. A run whose cancellation was already
+// recorded by the finished event of its stopped process stays as it is.
+func (r *Resolver) cancelRun(ctx context.Context, runName string) error {
+	_, err := r.RunStore.Transition(ctx, runName, model.RunStateCancelled, nil)
+	if errors.Is(err, runs.ErrInvalidTransition) {
+		run, getErr := r.RunStore.Get(ctx, runName)
+		if getErr == nil && run.State == model.RunStateCancelled {
+			return nil
+		}
+	}
+	if err != nil {
+		r.Logger.Error("failed to record run cancellation", "run_name", runName, "error", err)
+		return fmt.Errorf("failed to record cancellation of run %s: %w", runName, err)
+	}
+	return nil
+}
+
+// stopCancelled stops the process of a run that is cancelled. The cancel is
+// requested before the runner is signalled so a finished event arriving
+// before the run is moved to CANCELLED doesn't record it as failed.
+func (r *Resolver) stopCancelled(ctx context.Context, stop runner.StopConfig) error {
+	_, err := r.RunStore.RequestCancel(ctx, stop.RunName, true)
+	if err != nil {
+		return err
+	}
+
+	err = r.stopRun(stop.RunnerName, stop)
+	if err != nil {
+		// the process keeps running, its exit is not a cancellation
+		_, withdrawErr := r.RunStore.RequestCancel(ctx, stop.RunName, false)
+		if withdrawErr != nil {
+			r.Logger.Error("failed to withdraw run cancellation", "run_name", stop.RunName, "error", withdrawErr)
+		}
+		return err
+	}
+
+	return r.cancelRun(ctx, stop.RunName)
+}
+
+// runJob records a new run and queues or launches it
+func (r *Resolver) runJob(ctx context.Context, input model.RunJobCommand) (*model.RunJobResponse, error) {
+	executor, err := r.Runners.Lookup(input.Executor.Name)
+	if err != nil {
+		r.Logger.Error("run", "error", err)
+		return nil, err
+	}
+
+	input, err = commandRevision(input)
+	if err != nil {
+		return nil, err
+	}
+	params, err := commandParams(input)
+	if err != nil {
+		return nil, err
+	}
+
+	commit := r.resolveCommit(ctx, input)
+	validation := r.validateParams(ctx, input, commit, params)
+	if !validation.Valid {
+		return nil, invalidParamsError(validation.Errors)
+	}
+
+	priority := input.RunPriority()
+	_, err = r.RunStore.Create(ctx, model.Run{
+		RunName:         input.RunName,
+		Executor:        executor.Executor,
+		PipelineURL:     input.PipelineURL,
+		Revision:        input.Revision,
+		Parameters:      input.RunParameters(),
+		Params:          params,
+		User:            input.User,
+		Priority:        &priority,
+		ComputeOverride: &input.Executor.ComputeOverride,
+	})
+	if err != nil {
+		r.Logger.Error("run", "error", err)
+		return nil, err
+	}
+	r.publishWarnings(input.RunName, validation.Warnings)
+
+	run := runConfig(input, params).SetRunName(input.RunName)
+	if commit != "" {
+		// launch the commit the params were validated at
+		run = run.SetRevision(commit)
+	}
+
+	entry := queue.Entry[runner.RunConfig]{
+		RunName:  input.RunName,
+		Executor: executor.Executor,
+		Priority: priority.Rank(),
+		Value:    run,
+	}
+	if input.User != nil {
+		entry.User = *input.User
+	}
+
+	return r.submit(ctx, entry)
+}
+
+// commandParams returns the params of a command, which can't be combined
+// with a params file given as parameter
+func commandParams(input model.RunJobCommand) (map[string]interface{}, error) {
+	params, err := input.RunParams()
+	if err != nil {
+		return nil, err
+	}
+	if params != nil && slices.Contains(input.Args(), "-params-file") {
+		return nil, errors.New("params cannot be combined with a -params-file parameter")
+	}
+	return params, nil
+}
+
+// commandRevision moves a revision given with the -r or -revision parameter
+// to the command, only the revision of the command is pinned, validated and
+// recorded
+func commandRevision(input model.RunJobCommand) (model.RunJobCommand, error) {
+	param := input.RevisionParameter()
+	if param == "" {
+		return input, nil
+	}
+	if input.Revision != nil && *input.Revision != "" && *input.Revision != param {
+		return input, fmt.Errorf("revision %q conflicts with the -r parameter %q", *input.Revision, param)
+	}
+
+	input.Revision = &param
+	return input, nil
+}
+
+// runConfig returns the nextflow run of a command
+func runConfig(input model.RunJobCommand, params map[string]interface{}) runner.RunConfig {
+	run := runner.RunConfig{
+		Args:           input.Args(),
+		PipelineUrl:    input.PipelineURL,
+		ConfigOverride: input.Executor.ComputeOverride,
+		Params:         params,
+	}
+	if input.Revision != nil && *input.Revision != "" {
+		run = run.SetRevision(*input.Revision)
+	}
+	return run
+}
+
+// recordedConfig returns the nextflow run recorded for a run, at the commit
+// its last attempt ran when it was pinned
+func recordedConfig(run *model.Run) runner.RunConfig {
+	config := runner.RunConfig{
+		Args:        run.Args(),
+		PipelineUrl: run.PipelineURL,
+		Params:      run.Params,
+	}
+	if run.ComputeOverride != nil {
+		config.ConfigOverride = *run.ComputeOverride
+	}
+	if run.CommitSha != nil {
+		config = config.SetRevision(*run.CommitSha)
+	} else if run.Revision != nil {
+		config = config.SetRevision(*run.Revision)
+	}
+	return config
+}
+
+// queueEntry returns the queue entry launching a run with value
+func queueEntry(run *model.Run, value runner.RunConfig) queue.Entry[runner.RunConfig] {
+	entry := queue.Entry[runner.RunConfig]{
+		RunName:  run.RunName,
+		Executor: run.Executor,
+		Value:    value,
+	}
+	if run.User != nil {
+		entry.User = *run.User
+	}
+	if run.Priority != nil {
+		entry.Priority = run.Priority.Rank()
+	}
+	return entry
+}
+
+// RequeueRuns queues the runs that were waiting for a slot when the
+// previous worker stopped, the queue only lives in memory. Runs that were
+// preempted or resumed resume their last attempt.
+func (r *Resolver) RequeueRuns(ctx context.Context) error {
+	active, err := r.RunStore.Active(ctx)
+	if err != nil {
+		return err
+	}
+	slices.SortStableFunc(active, func(a, b *model.Run) int {
+		return strings.Compare(a.CreatedAt, b.CreatedAt)
+	})
+
+	for _, run := range active {
+		if run.State != model.RunStateQueued {
+			continue
+		}
+
+		config := recordedConfig(run)
+		if len(run.Attempts) == 0 {
+			config = config.SetRunName(run.RunName)
+		} else {
+			previous := run.Attempts[len(run.Attempts)-1]
+			resume := runner.AttemptName(run.RunName, previous.Attempt)
+			if previous.SessionID != nil && *previous.SessionID != "" {
+				resume = *previous.SessionID
+			}
+			config = config.NextAttempt(run.RunName, run.Attempt, resume)
+		}
+
+		entry := queueEntry(run, config)
+		position := r.RunQueue.Submit(entry)
+		r.Logger.Info("run queued again", "run_name", run.RunName, "position", position)
+		if position == 0 {
+			r.startQueued([]queue.Entry[runner.RunConfig]{entry})
+		}
+	}
+	return nil
+}
+
+// FireSchedule launches a run of the schedule's template
+func (r *Resolver) FireSchedule(ctx context.Context, schedule model.Schedule, runName string) error {
+	_, err := r.runJob(ctx, schedule.Command(runName))
+	return err
+}
+
+// submit queues a pending run or launches it right away when it gets a slot
+func (r *Resolver) submit(ctx context.Context, entry queue.Entry[runner.RunConfig]) (*model.RunJobResponse, error) {
+	position := r.RunQueue.Submit(entry)
+	if position > 0 {
+		r.Logger.Info("run queued", "run_name", entry.RunName, "position", position)
+
+		// the run may already have been admitted and started, a started
+		// run must not be moved back
+		_, err := r.RunStore.Queue(ctx, entry.RunName)
+		if err != nil && !errors.Is(err, runs.ErrInvalidTransition) {
+			r.Logger.Error("run", "error", err)
+			r.RunQueue.Remove(entry.RunName)
+			r.failRun(entry.RunName, err)
+			return nil, err
+		}
+
+		if r.Preemption && entry.Priority == model.RunPriorityCritical.Rank() {
+			go r.preempt(entry.RunName)
+		}
+
+		return &model.RunJobResponse{
+			Status:        true,
+			Executor:      entry.Executor,
+			RunName:       entry.RunName,
+			State:         model.RunStateQueued,
+			QueuePosition: &position,
+		}, nil
+	}
+
+	processId, err := r.launch(ctx, entry.RunName, entry.Executor, entry.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &model.RunJobResponse{
+		Status:     true,
+		ProcessKey: processId,
+		Executor:   entry.Executor,
+		RunName:    entry.RunName,
+		State:      model.RunStateRunning,
+	}
+	if run, err := r.RunStore.Get(ctx, entry.RunName); err == nil {
+		response.CommitSha = run.CommitSha
+	}
+	return response, nil
+}
+
+// launch validates and starts a run holding a queue slot. Failures are
+// recorded on the run, which releases the slot.
+func (r *Resolver) launch(ctx context.Context, runName string, executorName string, run runner.RunConfig) (string, error) {
+	executor, err := r.Runners.Lookup(executorName)
+	if err != nil {
+		r.failRun(runName, err)
+		return "", err
+	}
+
+	bgCtx := context.Background()
+	launchDir := ownLaunchDir(executor.Runner, runName)
+	if launchDir != "" {
+		err = runner.RemoveNfAssetsDir(launchDir)
+		if err != nil {
+			r.Logger.Error("run", "error", err)
+			r.failRun(runName, err)
+			return "", err
+		}
+	}
+
+	// leave QUEUED before the process exists: the finished event of a queued
+	// run is taken for that of a preempted attempt and dropped
+	_, err = r.RunStore.Transition(ctx, runName, model.RunStateValidating, nil)
+	if err != nil {
+		r.Logger.Error("run", "error", err)
+		r.failRun(runName, err)
+		return "", err
+	}
+
+	validator, canValidate := executor.Runner.(runner.Validator)
+
+	if canValidate {
+		err = validator.Validate(ctx, run)
+		if err != nil {
+			r.Logger.Error("run", "error", err)
+			r.failRun(runName, err)
+			return "", err
+		}
+	}
+
+	run = r.pinRevision(ctx, runName, run)
+	policy := r.Retry.For(executorName)
+
+	if executor.Capabilities.NeedsMock {
+		err = r.retryLaunch(ctx, runName, launchDir, policy, model.LogPhaseValidation, func() error {
+			return runner.MockExecute(ctx, r.Logger, run, r.NextflowBinPath, r.Js, runName, launchDir)
+		})
+		if err != nil {
+			r.Logger.Error("run", "error", err)
+			r.failRun(runName, err)
+			return "", err
+		}
+	}
+
+	// a run is only launched again when it can't have been submitted
+	submitPolicy := policy
+	submitPolicy.Retryable = runner.BeforeSubmit(policy.Retryable)
+
+	r.Logger.Info("job starting")
+	var processId string
+	err = r.retryLaunch(bgCtx, runName, launchDir, submitPolicy, model.LogPhaseRun, func() error {
+		processId, err = executor.Runner.Execute(bgCtx, run, runName)
+		return err
+	})
+	if err != nil {
+		r.Logger.Error("run", "error", err)
+		r.failRun(runName, err)
+		return "", err
+	}
+
+	r.Logger.Info("process running", "process_id", processId)
+
+	_, err = r.RunStore.Start(bgCtx, runName, processId)
+	if err != nil {
+		r.Logger.Error("failed to record run", "error", err)
+	}
+
+	return processId, nil
+}
+
+// ownLaunchDir returns the launch directory of a run when its runner starts
+// nextflow in one of its own, runs of other runners have none
+func ownLaunchDir(r runner.Runner, runName string) string {
+	if _, ok := r.(runner.LaunchDirer); !ok {
+		return ""
+	}
+	return runner.LaunchDir(r, runName)
+}
+
+// resolveCommit returns the commit the revision of a command points to,
+// empty when it can't be resolved. pinRevision tries again at launch.
+func (r *Resolver) resolveCommit(ctx context.Context, input model.RunJobCommand) string {
+	if r.Revisions == nil {
+		return ""
+	}
+
+	rev := ""
+	if input.Revision != nil {
+		rev = *input.Revision
+	}
+	sha, err := r.Revisions.Resolve(ctx, input.PipelineURL, rev)
+	if err != nil {
+		if !errors.Is(err, revision.ErrNotRepository) {
+			r.Logger.Info("failed to resolve pipeline revision", "pipeline_url", input.PipelineURL, "error", err)
+		}
+		return ""
+	}
+	return sha
+}
+
+// pinRevision resolves the revision of a run to the commit it points to,
+// records it and launches the run at that commit so the record tells which
+// code ran. Pipelines that can't be resolved, e.g. local or private ones,
+// are launched unpinned.
+func (r *Resolver) pinRevision(ctx context.Context, runName string, run runner.RunConfig) runner.RunConfig {
+	if r.Revisions == nil {
+		return run
+	}
+
+	sha, err := r.Revisions.Resolve(ctx, run.PipelineUrl, run.Revision)
+	if errors.Is(err, revision.ErrNotRepository) {
+		return run
+	}
+	if err != nil {
+		r.Logger.Info("failed to resolve pipeline revision", "run_name", runName, "error", err)
+		err = logstream.PublishLog(r.Js, runName, model.Log{
+			Message: fmt.Sprintf("Launching without a pinned commit, failed to resolve revision: %v", err),
+			Stream:  model.LogStreamSystem,
+			Level:   model.LogLevelWarn,
+			Phase:   model.LogPhaseValidation,
+		})
+		if err != nil {
+			r.Logger.Error("Failed to publish log", "error", err)
+		}
+		return run
+	}
+
+	_, err = r.RunStore.Update(ctx, runName, func(run *model.Run) error {
+		run.CommitSha = &sha
+		return nil
+	})
+	if err != nil {
+		r.Logger.Error("failed to record commit", "run_name", runName, "error", err)
+	}
+
+	r.Logger.Info("pipeline revision resolved", "run_name", runName, "revision", run.Revision, "commit", sha)
+	return run.SetRevision(sha)
+}
+
+// retryLaunch runs a launch phase under the retry policy of the executor,
+// recording every attempt on the run and in its log stream. The pipeline
+// pulled into launchDir, if set, is removed before every retry.
+func (r *Resolver) retryLaunch(ctx context.Context, runName string, launchDir string, policy retry.Policy, phase model.LogPhase, fn func() error) error {
+	return retry.Do(ctx, policy, func(attempt int) error {
+		if attempt > 1 && launchDir != "" {
+			// a corrupted asset cache would fail every attempt
+			err := runner.RemoveNfAssetsDir(launchDir)
+			if err != nil {
+				return err
+			}
+		}
+		return fn()
+	}, func(a retry.Attempt) {
+		step := "Launch"
+		if phase == model.LogPhaseValidation {
+			step = "Validation"
+		}
+
+		attempt := model.LaunchAttempt{Attempt: a.Number, Phase: phase, Retried: a.Retry}
+		log := model.Log{
+			Message: fmt.Sprintf("%s attempt %d succeeded", step, a.Number),
+			Stream:  model.LogStreamSystem,
+			Level:   model.LogLevelInfo,
+			Phase:   phase,
+		}
+		if a.Err != nil {
+			msg := strings.TrimSpace(a.Err.Error())
+			attempt.Error = &msg
+			log.Message = fmt.Sprintf("%s attempt %d of %d failed: %s", step, a.Number, max(policy.MaxAttempts, 1), msg)
+			log.Level = model.LogLevelError
+		}
+		if a.Retry {
+			log.Message += fmt.Sprintf(", retrying in %s", a.Delay)
+			log.Level = model.LogLevelWarn
+		}
+
+		r.Logger.Info("launch attempt", "run_name", runName, "attempt", a.Number, "phase", phase, "retry", a.Retry, "error", a.Err)
+		err := r.RunStore.AddLaunchAttempt(context.Background(), runName, attempt)
+		if err != nil {
+			r.Logger.Error("failed to record launch attempt", "run_name", runName, "error", err)
+		}
+		err = logstream.PublishLog(r.Js, runName, log)
+		if err != nil {
+			r.Logger.Error("Failed to publish log", "error", err)
+		}
+	})
+}
+
+// startQueued launches the runs admitted by the queue in the background
+func (r *Resolver) startQueued(entries []queue.Entry[runner.RunConfig]) {
+	for _, e := range entries {
+		go func() {
+			r.Logger.Info("starting queued run", "run_name", e.RunName)
+			_, err := r.launch(context.Background(), e.RunName, e.Executor, e.Value)
+			if err != nil {
+				r.Logger.Error("queued run failed to start", "run_name", e.RunName, "error", err)
+			}
+		}()
+	}
+}
+
+// WatchQueue releases the queue slot of every run reaching a terminal state
+// and starts the runs admitted in its place.
+func (r *Resolver) WatchQueue() (*nats.Subscription, error) {
+	return runs.SubscribeStatus(r.Nc, r.Logger, func(status model.RunStatus) {
+		if runs.IsTerminal(status.State) {
+			r.startQueued(r.RunQueue.Release(status.RunName))
+		}
+	})
+}
+
+// CaptureLogs attaches the nextflow log of every run reaching a terminal
+// state to its record
+func (r *Resolver) CaptureLogs() (*nats.Subscription, error) {
+	return runs.SubscribeStatus(r.Nc, r.Logger, func(status model.RunStatus) {
+		if !runs.IsTerminal(status.State) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		run, err := r.RunStore.Get(ctx, status.RunName)
+		if err != nil {
+			r.Logger.Error("failed to get run", "run_name", status.RunName, "error", err)
+			return
+		}
+		r.captureNextflowLog(ctx, run)
+	})
+}
+
+// captureNextflowLog attaches the end of the nextflow log of the current
+// attempt of a run to its record. Runs without a launch directory of their
+// own keep no log on the orchestrator.
+func (r *Resolver) captureNextflowLog(ctx context.Context, run *model.Run) {
+	executor, err := r.Runners.Lookup(run.Executor)
+	if err != nil {
+		return
+	}
+	launchDir := ownLaunchDir(executor.Runner, run.RunName)
+	if launchDir == "" {
+		return
+	}
+
+	path := runner.LogFile(launchDir, runner.AttemptName(run.RunName, run.Attempt))
+	log, err := runner.ReadLogTail(path, nextflowLogMaxBytes)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		r.Logger.Info("failed to read nextflow log", "run_name", run.RunName, "error", err)
+		return
+	}
+
+	err = r.RunStore.AttachNextflowLog(ctx, run.RunName, log)
+	if err != nil {
+		r.Logger.Error("failed to attach nextflow log", "run_name", run.RunName, "error", err)
+	}
+}
+
+// preempt stops the lowest priority resumable run holding a slot the
+// waiting run needs and queues it again to resume from its cached work
+func (r *Resolver) preempt(runName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	victim, ok := r.RunQueue.Victim(runName, func(e queue.Entry[runner.RunConfig]) bool {
+		executor, err := r.Runners.Lookup(e.Executor)
+		return err == nil && executor.Capabilities.CanStop && executor.Capabilities.CanResume
+	})
+	if !ok {
+		r.Logger.Info("no run to preempt", "run_name", runName)
+		return
+	}
+
+	// only running runs have a process to stop, finished events of the
+	// stopped process are ignored once the run is queued
+	run, err := r.RunStore.Transition(ctx, victim.RunName, model.RunStateQueued, nil)
+	if err != nil {
+		r.Logger.Info("failed to preempt run", "run_name", victim.RunName, "error", err)
+		return
+	}
+
+	r.Logger.Info("preempting run", "run_name", victim.RunName, "for", runName)
+	err = r.stopRun(run.Executor, runner.StopConfig{
+		ProcessId:  run.ProcessKey,
+		RunnerName: run.Executor,
+		RunName:    run.RunName,
+	})
+	if err != nil && !errors.Is(err, runner.ErrAlreadyFinished) && r.processAlive(ctx, run) {
+		// the process is still running and keeps its slot. A gone process is
+		// preempted all the same, its finished event was dropped as stale so
+		// the resumed attempt records the outcome.
+		_, err = r.RunStore.Start(ctx, run.RunName, run.ProcessKey)
+		if err != nil {
+			r.Logger.Error("failed to restore preempted run", "run_name", run.RunName, "error", err)
+		}
+		return
+	}
+
+	executor, err := r.Runners.Lookup(run.Executor)
+	if err != nil {
+		r.Logger.Error("failed to preempt run", "run_name", run.RunName, "error", err)
+		return
+	}
+
+	previous := runner.AttemptName(run.RunName, run.Attempt)
+	sessionID, err := runner.SessionID(runner.LaunchDir(executor.Runner, run.RunName), previous)
+	resume := sessionID
+	if err != nil {
+		r.Logger.Warn("no session found, resuming by run name", "run_name", run.RunName, "error", err)
+		resume = previous
+	}
+
+	r.captureNextflowLog(ctx, run)
+	run, err = r.RunStore.NewAttempt(ctx, run.RunName, sessionID, fmt.Errorf("preempted by critical run %s", runName))
+	if err != nil {
+		r.Logger.Error("failed to record preempted attempt", "run_name", victim.RunName, "error", err)
+		return
+	}
+
+	err = logstream.PublishLog(r.Js, run.RunName, model.Log{
+		Message: fmt.Sprintf("Preempted by critical run %s, queued to resume as attempt %d", runName, run.Attempt),
+		Level:   model.LogLevelWarn,
+	})
+	if err != nil {
+		r.Logger.Error("Failed to publish log", "error", err)
+	}
+
+	// the next attempt resumes the code of the preempted one
+	next := victim.Value.NextAttempt(run.RunName, run.Attempt, resume)
+	if run.CommitSha != nil {
+		next = next.SetRevision(*run.CommitSha)
+	}
+	r.startQueued(r.RunQueue.Requeue(run.RunName, next))
+}
+
+// processAlive reports whether the process of a run may still exist after
+// stopping it failed. Stopping can fail once the process is gone, e.g. when
+// cleaning up after it fails or the process exited meanwhile, a gone process
+// no longer holds its slot. Runners that can't tell are taken as alive.
+func (r *Resolver) processAlive(ctx context.Context, run *model.Run) bool {
+	executor, err := r.Runners.Lookup(run.Executor)
+	if err != nil {
+		return true
+	}
+	prober, ok := executor.Runner.(runner.Prober)
+	if !ok {
+		return true
+	}
+
+	alive, err := prober.Alive(ctx, run.ProcessKey)
+	if err != nil {
+		r.Logger.Error("failed to check process", "run_name", run.RunName, "error", err)
+		return true
+	}
+	return alive
+}
+
+// stopRun stops the process of a run through its executor
+func (r *Resolver) stopRun(executorName string, stop runner.StopConfig) error {
+	executor, err := r.Runners.Lookup(executorName)
+	if err != nil {
+		return err
+	}
+	if !executor.Capabilities.CanStop {
+		return fmt.Errorf("executor %q does not support stopping jobs", executorName)
+	}
+
+	err = executor.Runner.Stop(stop)
+	if err != nil {
+		r.Logger.Error("stop process", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// sendLatest sends a status without blocking, a subscriber that falls
+// behind loses its oldest status as only the latest one matters
+func sendLatest(statusChan chan *model.RunStatus, status *model.RunStatus) {
+	for {
+		select {
+		case statusChan <- status:
+			return
+		default:
+		}
+
+		select {
+		case <-statusChan:
+		default:
+		}
+	}
+}
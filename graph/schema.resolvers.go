@@ -8,7 +8,9 @@ import (
 	"github.com/nats-io/nats.go"
 	"nf-shard-orchestrator/graph/model"
 	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runs"
 	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"nf-shard-orchestrator/pkg/templates"
 	"time"
 )
 
@@ -18,79 +20,213 @@ var logsCache = make(map[string][]*model.Log)
 func (r *mutationResolver) RunJob(ctx context.Context, input model.RunJobCommand) (*model.RunJobResponse, error) {
 	r.Logger.Debug("Received request to launch workflow")
 
-	run := runner.RunConfig{
-		Args:           input.Args(),
-		PipelineUrl:    input.PipelineURL,
-		ConfigOverride: input.Executor.ComputeOverride,
+	return r.runJob(ctx, input)
+}
+
+// TerminateJob is the resolver for the terminateJob field.
+func (r *mutationResolver) TerminateJob(ctx context.Context, input model.TerminateJobCommand) (bool, error) {
+	r.Logger.Debug("Received request to stop job")
+
+	terminate := runner.StopConfig{
+		ProcessId:  input.ProcessKey,
+		RunnerName: input.Executor,
+	}
+
+	run, err := r.RunStore.FindByProcessKey(ctx, input.Executor, input.ProcessKey)
+	if err != nil {
+		r.Logger.Warn("no run recorded for process", "executor", input.Executor, "process_key", input.ProcessKey, "error", err)
+	} else {
+		terminate.RunName = run.RunName
+	}
+
+	if run == nil {
+		err = r.stopRun(input.Executor, terminate)
+	} else {
+		err = r.stopCancelled(ctx, terminate)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// CancelRun is the resolver for the cancelRun field.
+func (r *mutationResolver) CancelRun(ctx context.Context, runName string) (bool, error) {
+	run, err := r.RunStore.Get(ctx, runName)
+	if err != nil {
+		return false, err
+	}
+	if runs.IsTerminal(run.State) {
+		return false, fmt.Errorf("run %s is already %s", runName, run.State)
+	}
+
+	if r.RunQueue.Remove(runName) {
+		err = r.cancelRun(ctx, runName)
+		return err == nil, err
 	}
-	run = run.SetRunName(input.RunName)
 
-	bgCtx := context.Background()
-	err := runner.RemoveNfAssetsDir()
+	if run.ProcessKey == "" {
+		return false, fmt.Errorf("run %s is starting and has no process to stop yet", runName)
+	}
+
+	err = r.stopCancelled(ctx, runner.StopConfig{
+		ProcessId:  run.ProcessKey,
+		RunnerName: run.Executor,
+		RunName:    runName,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ResumeRun is the resolver for the resumeRun field.
+func (r *mutationResolver) ResumeRun(ctx context.Context, runName string) (*model.RunJobResponse, error) {
+	run, err := r.RunStore.Get(ctx, runName)
 	if err != nil {
-		r.Logger.Error("run", "error", err)
 		return nil, err
 	}
 
-	err = runner.MockExecute(ctx, r.Logger, run, r.NFService.BinPath(), r.Nc, input.RunName, r.LogCache)
+	executor, err := r.Runners.Lookup(run.Executor)
 	if err != nil {
-		r.Logger.Error("run", "error", err)
 		return nil, err
 	}
+	if !executor.Capabilities.CanResume {
+		return nil, fmt.Errorf("executor %q does not support resuming runs", run.Executor)
+	}
+	if run.State != model.RunStateFailed && run.State != model.RunStateCancelled {
+		return nil, fmt.Errorf("only failed or cancelled runs can be resumed, run %s is %s", runName, run.State)
+	}
 
-	r.Logger.Info("job starting")
-	var processId string
-	switch input.Executor.Name {
-	case "float":
-		processId, err = r.FloatService.Execute(bgCtx, run, input.RunName)
-	case "awsbatch", "google-batch":
-		processId, err = r.NFService.Execute(bgCtx, run, input.RunName)
-	default:
-		r.Logger.Error("Invalid executor", "executor", input.Executor.Name)
+	previous := runner.AttemptName(runName, run.Attempt)
+	sessionID, err := runner.SessionID(runner.LaunchDir(executor.Runner, runName), previous)
+	resume := sessionID
+	if err != nil {
+		// nextflow also resumes by run name
+		r.Logger.Warn("no session found, resuming by run name", "run_name", runName, "error", err)
+		resume = previous
 	}
 
+	run, err = r.RunStore.NewAttempt(ctx, runName, sessionID, nil)
 	if err != nil {
-		r.Logger.Error("run", "error", err)
 		return nil, err
 	}
 
-	r.Logger.Info("process running", "process_id", processId)
+	err = logstream.PublishLog(r.Js, runName, model.Log{
+		Message: fmt.Sprintf("Resuming run as attempt %d from %s", run.Attempt, resume),
+	})
+	if err != nil {
+		r.Logger.Error("Failed to publish log", "error", err)
+	}
 
-	return &model.RunJobResponse{
-		Status:     true,
-		ProcessKey: processId,
-		Executor:   input.Executor.Name,
-		RunName:    input.RunName,
-	}, nil
+	// resume the code of the previous attempt
+	config := recordedConfig(run).NextAttempt(runName, run.Attempt, resume)
+	return r.submit(ctx, queueEntry(run, config))
 }
 
-// TerminateJob is the resolver for the terminateJob field.
-func (r *mutationResolver) TerminateJob(ctx context.Context, input model.TerminateJobCommand) (bool, error) {
-	r.Logger.Debug("Received request to stop job")
+// CreateSchedule is the resolver for the createSchedule field.
+func (r *mutationResolver) CreateSchedule(ctx context.Context, input model.ScheduleCommand) (*model.Schedule, error) {
+	template := input.Template
+	executor, err := r.Runners.Lookup(template.Executor.Name)
+	if err != nil {
+		return nil, err
+	}
 
-	terminate := runner.StopConfig{
-		ProcessId:  input.ProcessKey,
-		RunnerName: input.Executor,
+	params, err := template.RunParams()
+	if err != nil {
+		return nil, err
 	}
 
-	var err error
-	switch input.Executor {
-	case "float":
-		err = r.FloatService.Stop(terminate)
-	case "awsbatch", "google-batch":
-		err = r.NFService.Stop(terminate)
-	default:
-		return false, errors.New("could not find executor")
+	overlap := model.ScheduleOverlapSkip
+	if input.Overlap != nil {
+		overlap = *input.Overlap
 	}
+	priority := template.RunPriority()
 
+	return r.Scheduler.Create(ctx, model.Schedule{
+		Name:            input.Name,
+		Cron:            input.Cron,
+		Overlap:         overlap,
+		RunNamePrefix:   template.RunName,
+		PipelineURL:     template.PipelineURL,
+		Revision:        template.Revision,
+		Executor:        executor.Executor,
+		ComputeOverride: template.Executor.ComputeOverride,
+		Parameters:      template.RunParameters(),
+		Params:          params,
+		User:            template.User,
+		Priority:        &priority,
+	})
+}
+
+// PauseSchedule is the resolver for the pauseSchedule field.
+func (r *mutationResolver) PauseSchedule(ctx context.Context, name string) (*model.Schedule, error) {
+	return r.Scheduler.SetPaused(ctx, name, true)
+}
+
+// ResumeSchedule is the resolver for the resumeSchedule field.
+func (r *mutationResolver) ResumeSchedule(ctx context.Context, name string) (*model.Schedule, error) {
+	return r.Scheduler.SetPaused(ctx, name, false)
+}
+
+// DeleteSchedule is the resolver for the deleteSchedule field.
+func (r *mutationResolver) DeleteSchedule(ctx context.Context, name string) (bool, error) {
+	err := r.Scheduler.Delete(ctx, name)
 	if err != nil {
-		r.Logger.Error("stop process", "error", err)
 		return false, err
 	}
+	return true, nil
+}
+
+// CreateLaunchTemplate is the resolver for the createLaunchTemplate field.
+func (r *mutationResolver) CreateLaunchTemplate(ctx context.Context, input model.LaunchTemplateInput) (*model.LaunchTemplate, error) {
+	_, err := r.Runners.Lookup(input.Executor.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.TemplateStore.Create(ctx, input.Template())
+}
 
+// UpdateLaunchTemplate is the resolver for the updateLaunchTemplate field.
+func (r *mutationResolver) UpdateLaunchTemplate(ctx context.Context, id string, input model.LaunchTemplateInput) (*model.LaunchTemplate, error) {
+	_, err := r.Runners.Lookup(input.Executor.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.TemplateStore.Replace(ctx, id, input.Template())
+}
+
+// DeleteLaunchTemplate is the resolver for the deleteLaunchTemplate field.
+func (r *mutationResolver) DeleteLaunchTemplate(ctx context.Context, id string) (bool, error) {
+	err := r.TemplateStore.Delete(ctx, id)
+	if err != nil {
+		return false, err
+	}
 	return true, nil
 }
 
+// RunFromTemplate is the resolver for the runFromTemplate field.
+func (r *mutationResolver) RunFromTemplate(ctx context.Context, templateID string, overrides model.TemplateOverrides) (*model.RunJobResponse, error) {
+	template, err := r.TemplateStore.Get(ctx, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Logger.Debug("Received request to launch workflow from template", "template", template.Name)
+	return r.runJob(ctx, templates.Command(*template, overrides))
+}
+
+// ValidateRun is the resolver for the validateRun field.
+func (r *mutationResolver) ValidateRun(ctx context.Context, input model.RunJobCommand) (*model.RunPreview, error) {
+	r.Logger.Debug("Received request to preview workflow")
+
+	return r.previewRun(ctx, input)
+}
+
 // HealthCheck is the resolver for the healthCheck field.
 func (r *queryResolver) HealthCheck(ctx context.Context) (bool, error) {
 	fmt.Println("healh check now")
@@ -102,60 +238,186 @@ func (r *queryResolver) CheckStatus(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
-// StreamLogs is the resolver for the streamLogs field.
-func (r *subscriptionResolver) StreamLogs(ctx context.Context, runName string) (<-chan *model.Log, error) {
-	if runName == "" {
+// Run is the resolver for the run field.
+func (r *queryResolver) Run(ctx context.Context, runName string) (*model.Run, error) {
+	run, err := r.RunStore.Get(ctx, runName)
+	if errors.Is(err, runs.ErrNotFound) {
 		return nil, nil
 	}
+	return run, err
+}
 
-	// Create a buffered channel to handle log spikes
-	logChan := make(chan *model.Log, 1000) // Adjust buffer size as needed
-	subject := fmt.Sprintf("%s.%s", logstream.SubjectPrefix, runName)
+// Runs is the resolver for the runs field.
+func (r *queryResolver) Runs(ctx context.Context, filter *model.RunFilter, page *model.PageInput) (*model.RunPage, error) {
+	return r.Resolver.RunStore.List(ctx, filter, page)
+}
 
-	go func() {
-		defer close(logChan)
+// RunStatus is the resolver for the runStatus field.
+func (r *queryResolver) RunStatus(ctx context.Context, runName string) (*model.RunStatus, error) {
+	run, err := r.RunStore.Get(ctx, runName)
+	if errors.Is(err, runs.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return runs.Status(run), nil
+}
 
-		sub, err := r.Nc.Subscribe(subject, func(msg *nats.Msg) {
-			var log model.Log
-			if err := json.Unmarshal(msg.Data, &log); err != nil {
-				r.Logger.Error("Failed to unmarshal log", "error", err)
-				return
-			}
+// Executors is the resolver for the executors field.
+func (r *queryResolver) Executors(ctx context.Context) ([]*model.ExecutorInfo, error) {
+	regs := r.Runners.Registrations()
 
-			time.Sleep(50 * time.Millisecond)
-			select {
-			case logChan <- &log:
-			case <-ctx.Done():
-				return
-			}
+	executors := make([]*model.ExecutorInfo, 0, len(regs))
+	for _, reg := range regs {
+		executors = append(executors, &model.ExecutorInfo{
+			Name:      reg.Executor,
+			CanStop:   reg.Capabilities.CanStop,
+			CanResume: reg.Capabilities.CanResume,
+			NeedsMock: reg.Capabilities.NeedsMock,
 		})
-		if err != nil {
-			select {
-			case logChan <- &model.Log{Message: fmt.Sprintf("Failed to subscribe to NATS: %v", err)}:
-			case <-ctx.Done():
-			}
-			return
+	}
+	return executors, nil
+}
+
+// Logs is the resolver for the logs field.
+func (r *queryResolver) Logs(ctx context.Context, runName string, offset *int, limit *int, search *string) (*model.LogPage, error) {
+	var o, l int
+	var s string
+	if offset != nil {
+		o = *offset
+	}
+	if limit != nil {
+		l = *limit
+	}
+	if search != nil {
+		s = *search
+	}
+
+	return r.LogHistory.Page(ctx, runName, o, l, s)
+}
+
+// Schedules is the resolver for the schedules field.
+func (r *queryResolver) Schedules(ctx context.Context) ([]*model.Schedule, error) {
+	return r.ScheduleStore.List(ctx)
+}
+
+// LaunchTemplate is the resolver for the launchTemplate field.
+func (r *queryResolver) LaunchTemplate(ctx context.Context, id string) (*model.LaunchTemplate, error) {
+	template, err := r.TemplateStore.Get(ctx, id)
+	if errors.Is(err, templates.ErrNotFound) {
+		return nil, nil
+	}
+	return template, err
+}
+
+// LaunchTemplates is the resolver for the launchTemplates field.
+func (r *queryResolver) LaunchTemplates(ctx context.Context) ([]*model.LaunchTemplate, error) {
+	return r.TemplateStore.List(ctx)
+}
+
+// ValidateRun is the resolver for the validateRun field.
+func (r *queryResolver) ValidateRun(ctx context.Context, input model.RunJobCommand) (*model.RunValidation, error) {
+	input, err := commandRevision(input)
+	if err != nil {
+		return nil, err
+	}
+	params, err := commandParams(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.validateParams(ctx, input, r.resolveCommit(ctx, input), params), nil
+}
+
+// QueuePosition is the resolver for the queuePosition field.
+func (r *runResolver) QueuePosition(ctx context.Context, obj *model.Run) (*int, error) {
+	if obj.State != model.RunStateQueued {
+		return nil, nil
+	}
+
+	position := r.RunQueue.Position(obj.RunName)
+	if position == 0 {
+		return nil, nil
+	}
+	return &position, nil
+}
+
+// NextFireAt is the resolver for the nextFireAt field.
+func (r *scheduleResolver) NextFireAt(ctx context.Context, obj *model.Schedule) (*string, error) {
+	if obj.Paused {
+		return nil, nil
+	}
+
+	next, ok := r.Scheduler.Next(obj.Name)
+	if !ok {
+		return nil, nil
+	}
+	ts := next.UTC().Format(time.RFC3339)
+	return &ts, nil
+}
+
+// StreamLogs is the resolver for the streamLogs field.
+func (r *subscriptionResolver) StreamLogs(ctx context.Context, runName string, afterSeq *int) (<-chan *model.Log, error) {
+	if runName == "" {
+		return nil, nil
+	}
+	if !runs.ValidName(runName) {
+		return nil, fmt.Errorf("%w: %q", runs.ErrInvalidName, runName)
+	}
+
+	var after uint64
+	if afterSeq != nil {
+		if *afterSeq < 0 {
+			return nil, fmt.Errorf("invalid afterSeq: %d", *afterSeq)
 		}
-		defer sub.Unsubscribe()
+		after = uint64(*afterSeq)
+	}
 
-		// Wait for context cancellation
-		<-ctx.Done()
-	}()
+	return logstream.Subscribe(ctx, r.Js, runName, after)
+}
+
+// RunStatusChanged is the resolver for the runStatusChanged field.
+func (r *subscriptionResolver) RunStatusChanged(ctx context.Context, runName string) (<-chan *model.RunStatus, error) {
+	run, err := r.RunStore.Get(ctx, runName)
+	if err != nil {
+		return nil, err
+	}
+
+	statusChan := make(chan *model.RunStatus, 10)
+
+	// nats drops messages for a full channel instead of blocking the
+	// connection
+	msgs := make(chan *nats.Msg, 64)
+	sub, err := r.Nc.ChanSubscribe(runs.StatusSubject(runName), msgs)
+	if err != nil {
+		return nil, err
+	}
+
+	// current status first, so clients don't miss a change that happened
+	// before they subscribed
+	statusChan <- runs.Status(run)
 
 	go func() {
-		// Feed logs from cache
-		logs := r.LogCache.Get(runName)
-		for _, log := range logs {
-			time.Sleep(50 * time.Millisecond)
+		defer close(statusChan)
+		defer sub.Unsubscribe()
+
+		for {
 			select {
-			case logChan <- &log:
 			case <-ctx.Done():
 				return
+			case msg := <-msgs:
+				var status model.RunStatus
+				if err := json.Unmarshal(msg.Data, &status); err != nil {
+					r.Logger.Error("Failed to unmarshal run status", "error", err)
+					continue
+				}
+				sendLatest(statusChan, &status)
 			}
 		}
 	}()
 
-	return logChan, nil
+	return statusChan, nil
 }
 
 // Mutation returns MutationResolver implementation.
@@ -164,9 +426,17 @@ func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 // Query returns QueryResolver implementation.
 func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 
+// Run returns RunResolver implementation.
+func (r *Resolver) Run() RunResolver { return &runResolver{r} }
+
+// Schedule returns ScheduleResolver implementation.
+func (r *Resolver) Schedule() ScheduleResolver { return &scheduleResolver{r} }
+
 // Subscription returns SubscriptionResolver implementation.
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type runResolver struct{ *Resolver }
+type scheduleResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
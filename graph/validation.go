@@ -0,0 +1,218 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/pipelineschema"
+	"nf-shard-orchestrator/pkg/revision"
+	"nf-shard-orchestrator/pkg/runner"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// code of the error runJob returns for params that don't match the schema
+const invalidParamsCode = "INVALID_PARAMETERS"
+
+// maximum time a preview may take, it holds a preview slot meanwhile
+const previewTimeout = 10 * time.Minute
+
+// config overrides setting params, e.g. `params.outdir = ...` or `params {`
+var paramsConfigRegex = regexp.MustCompile(`(^|[^.\w])params\s*[.{]`)
+
+// validateParams checks the params of a run against the nextflow_schema.json
+// of its pipeline at the requested revision. Pipelines without a schema pass,
+// failures to fetch or read the schema are warnings and skip the check.
+// The schema is read at commit when the revision was resolved to one.
+func (r *Resolver) validateParams(ctx context.Context, input model.RunJobCommand, commit string, params map[string]interface{}) *model.RunValidation {
+	validation := &model.RunValidation{
+		Valid:    true,
+		Errors:   []*model.ParameterError{},
+		Warnings: []string{},
+	}
+	if r.Schemas == nil {
+		return validation
+	}
+
+	skip := func(format string, args ...any) *model.RunValidation {
+		validation.Warnings = append(validation.Warnings, fmt.Sprintf(format, args...))
+		return validation
+	}
+
+	args := input.Args()
+	// params nextflow reads from files on the worker would be reported missing
+	if slices.Contains(args, "-params-file") {
+		return skip("Parameters were not validated, params given with -params-file cannot be checked")
+	}
+	if paramsConfigRegex.MatchString(input.Executor.ComputeOverride) {
+		return skip("Parameters were not validated, the config override sets params")
+	}
+
+	rev := commit
+	if rev == "" && input.Revision != nil {
+		rev = *input.Revision
+	}
+
+	data, err := r.Schemas.Fetch(ctx, input.PipelineURL, rev)
+	if errors.Is(err, pipelineschema.ErrNotFound) || errors.Is(err, revision.ErrNotRepository) {
+		return validation
+	}
+	if err != nil {
+		r.Logger.Info("failed to fetch pipeline schema", "pipeline_url", input.PipelineURL, "error", err)
+		return skip("Parameters were not validated, failed to fetch %s: %v", pipelineschema.FileName, err)
+	}
+	validation.SchemaFound = true
+
+	schema, err := pipelineschema.Parse(data)
+	if err != nil {
+		return skip("Parameters were not validated: %v", err)
+	}
+
+	fieldErrors, err := schema.Validate(schema.Params(args, params))
+	if err != nil {
+		return skip("Parameters were not validated: %v", err)
+	}
+
+	for _, e := range fieldErrors {
+		validation.Errors = append(validation.Errors, &model.ParameterError{
+			Field:   e.Field,
+			Message: e.Message,
+			Keyword: &e.Keyword,
+		})
+	}
+	validation.Valid = len(validation.Errors) == 0
+
+	return validation
+}
+
+// previewRun checks a run without launching it, its params against the
+// pipeline schema and the pipeline itself with a nextflow preview
+func (r *Resolver) previewRun(ctx context.Context, input model.RunJobCommand) (*model.RunPreview, error) {
+	_, err := r.Runners.Lookup(input.Executor.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err = commandRevision(input)
+	if err != nil {
+		return nil, err
+	}
+	params, err := commandParams(input)
+	if err != nil {
+		return nil, err
+	}
+
+	commit := r.resolveCommit(ctx, input)
+	result := &model.RunPreview{
+		Processes:  []string{},
+		Warnings:   []string{},
+		Parameters: r.validateParams(ctx, input, commit, params),
+	}
+
+	run := runConfig(input, params)
+	if commit != "" {
+		run = run.SetRevision(commit)
+	}
+	if !runner.CanPreview(run) {
+		result.Success = result.Parameters.Valid
+		result.Warnings = append(result.Warnings, "Pipelines run with -main-script cannot be previewed")
+		return result, nil
+	}
+
+	// every preview starts a JVM and pulls the pipeline
+	if r.Previews != nil {
+		select {
+		case r.Previews <- struct{}{}:
+			defer func() { <-r.Previews }()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for a preview slot: %w", ctx.Err())
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+
+	// nextflow refuses to reuse a run name, the preview is launched in a
+	// directory of its own as the run doesn't exist yet
+	previewName := input.RunName + "-preview-" + uuid.NewString()[:8]
+	preview, err := runner.RunPreview(ctx, r.Logger, run, r.NextflowBinPath, previewName, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run nextflow preview: %w", err)
+	}
+
+	result.Success = preview.Err == nil && result.Parameters.Valid
+	result.Processes = preview.Processes
+	result.Warnings = append(result.Warnings, preview.Warnings...)
+	result.Output = preview.Output
+	if preview.Error != nil {
+		result.Error = previewError(preview.Error)
+	}
+
+	return result, nil
+}
+
+// previewError returns the error of a preview, with its location when
+// nextflow pointed to one
+func previewError(e *runner.PreviewError) *model.PreviewError {
+	result := &model.PreviewError{Message: e.Message}
+	if e.File == "" && e.Line == 0 {
+		return result
+	}
+
+	location := &model.ErrorLocation{}
+	if e.File != "" {
+		location.File = &e.File
+	}
+	if e.Line > 0 {
+		location.Line = &e.Line
+	}
+	if e.Column > 0 {
+		location.Column = &e.Column
+	}
+	result.Location = location
+	return result
+}
+
+// invalidParamsError lists the params that don't match the schema in the
+// extensions of the error, so clients can show them next to their fields
+func invalidParamsError(fieldErrors []*model.ParameterError) error {
+	messages := make([]string, 0, len(fieldErrors))
+	details := make([]map[string]interface{}, 0, len(fieldErrors))
+	for _, e := range fieldErrors {
+		messages = append(messages, e.Field+": "+e.Message)
+		details = append(details, map[string]interface{}{
+			"field":   e.Field,
+			"message": e.Message,
+			"keyword": e.Keyword,
+		})
+	}
+
+	return &gqlerror.Error{
+		Message: "invalid pipeline parameters: " + strings.Join(messages, "; "),
+		Extensions: map[string]interface{}{
+			"code":   invalidParamsCode,
+			"errors": details,
+		},
+	}
+}
+
+// publishWarnings adds the validation warnings to the log of a run
+func (r *Resolver) publishWarnings(runName string, warnings []string) {
+	for _, warning := range warnings {
+		err := logstream.PublishLog(r.Js, runName, model.Log{
+			Message: warning,
+			Stream:  model.LogStreamSystem,
+			Level:   model.LogLevelWarn,
+			Phase:   model.LogPhaseValidation,
+		})
+		if err != nil {
+			r.Logger.Error("Failed to publish log", "error", err)
+		}
+	}
+}
@@ -32,6 +32,20 @@ func AuthMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireToken rejects requests without a valid token, for plain HTTP
+// endpoints outside of the GraphQL schema.
+func RequireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userToken, ok := r.Context().Value(userCtxKey).(string)
+		if !ok || userToken != os.Getenv("TOKEN") {
+			http.Error(w, "access denied: invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func Authorized() func(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
 	return func(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
 		appToken := os.Getenv("TOKEN")
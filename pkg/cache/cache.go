@@ -1,44 +1,192 @@
 package cache
 
 import (
+	"container/list"
 	"sync"
+	"time"
 )
 
+type Config struct {
+	// MaxItemsPerKey bounds the items kept per key, the oldest items are
+	// dropped first. Zero means unbounded.
+	MaxItemsPerKey int
+	// MaxKeys bounds the number of keys, the least recently used key is
+	// evicted first. Zero means unbounded.
+	MaxKeys int
+	// TTL is how long a key is kept after Expire is called for it.
+	TTL time.Duration
+}
+
+type Stats struct {
+	Keys          int    `json:"keys"`
+	Items         int    `json:"items"`
+	ItemEvictions uint64 `json:"itemEvictions"`
+	KeyEvictions  uint64 `json:"keyEvictions"`
+	Expirations   uint64 `json:"expirations"`
+}
+
+type entry[T any] struct {
+	key string
+	// ring buffer of items, start is the index of the oldest one
+	items   []T
+	start   int
+	evicted bool
+	// position in the LRU list
+	elem      *list.Element
+	expiresAt time.Time
+}
+
+func (e *entry[T]) add(item T, max int) bool {
+	if max <= 0 || len(e.items) < max {
+		e.items = append(e.items, item)
+		return false
+	}
+
+	e.items[e.start] = item
+	e.start = (e.start + 1) % len(e.items)
+	e.evicted = true
+	return true
+}
+
+func (e *entry[T]) list() []T {
+	items := make([]T, 0, len(e.items))
+	items = append(items, e.items[e.start:]...)
+	return append(items, e.items[:e.start]...)
+}
+
 type Cache[T any] struct {
-	cache map[string][]T
-	mutex sync.RWMutex
+	config Config
+	cache  map[string]*entry[T]
+	lru    *list.List
+	stats  Stats
+	mutex  sync.RWMutex
 }
 
-func NewCache[T any]() *Cache[T] {
+func NewCache[T any](c Config) *Cache[T] {
 	return &Cache[T]{
-		cache: make(map[string][]T),
+		config: c,
+		cache:  make(map[string]*entry[T]),
+		lru:    list.New(),
 	}
 }
 
 func (c *Cache[T]) Add(key string, item T) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	// No need to check if the key exists; append works fine either way
-	c.cache[key] = append(c.cache[key], item)
+
+	e, exists := c.cache[key]
+	if !exists {
+		e = &entry[T]{key: key}
+		e.elem = c.lru.PushFront(e)
+		c.cache[key] = e
+		c.evictKeys()
+	} else {
+		c.lru.MoveToFront(e.elem)
+	}
+
+	// new items revive a key that was about to expire
+	e.expiresAt = time.Time{}
+
+	if e.add(item, c.config.MaxItemsPerKey) {
+		c.stats.ItemEvictions++
+	}
+}
+
+// evictKeys drops least recently used keys above the limit
+func (c *Cache[T]) evictKeys() {
+	if c.config.MaxKeys <= 0 {
+		return
+	}
+
+	for len(c.cache) > c.config.MaxKeys {
+		oldest := c.lru.Back().Value.(*entry[T])
+		c.remove(oldest)
+		c.stats.KeyEvictions++
+	}
+}
+
+func (c *Cache[T]) remove(e *entry[T]) {
+	c.lru.Remove(e.elem)
+	delete(c.cache, e.key)
+}
+
+// Expire removes the key once the configured TTL has passed, unless new
+// items are added in the meantime. Without a TTL the key is removed
+// immediately.
+func (c *Cache[T]) Expire(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, exists := c.cache[key]
+	if !exists {
+		return
+	}
+
+	if c.config.TTL <= 0 {
+		c.remove(e)
+		c.stats.Expirations++
+		return
+	}
+
+	e.expiresAt = time.Now().Add(c.config.TTL)
+	time.AfterFunc(c.config.TTL, func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		// the key may have been replaced, revived or evicted since
+		if current, ok := c.cache[key]; ok && current == e && !e.expiresAt.IsZero() && !time.Now().Before(e.expiresAt) {
+			c.remove(e)
+			c.stats.Expirations++
+		}
+	})
 }
 
 func (c *Cache[T]) Remove(key string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	delete(c.cache, key)
+
+	if e, exists := c.cache[key]; exists {
+		c.remove(e)
+	}
 }
 
 func (c *Cache[T]) Clear() {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.cache = make(map[string][]T)
+	c.cache = make(map[string]*entry[T])
+	c.lru.Init()
 }
 
+// Get returns a copy of the items of key, oldest first.
 func (c *Cache[T]) Get(key string) []T {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, exists := c.cache[key]; exists {
+		c.lru.MoveToFront(e.elem)
+		return e.list()
+	}
+	return []T{}
+}
+
+// Evicted reports whether items of key were dropped because the key held
+// more than MaxItemsPerKey items.
+func (c *Cache[T]) Evicted(key string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	e, exists := c.cache[key]
+	return exists && e.evicted
+}
+
+func (c *Cache[T]) Stats() Stats {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	if value, exists := c.cache[key]; exists {
-		return value
+
+	stats := c.stats
+	stats.Keys = len(c.cache)
+	for _, e := range c.cache {
+		stats.Items += len(e.items)
 	}
-	return []T{}
+	return stats
 }
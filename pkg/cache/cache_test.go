@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCacheRingBuffer(t *testing.T) {
+	c := NewCache[int](Config{MaxItemsPerKey: 3})
+
+	for i := 1; i <= 5; i++ {
+		c.Add("run", i)
+	}
+
+	if got, want := c.Get("run"), []int{3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %v, want %v", got, want)
+	}
+	if !c.Evicted("run") {
+		t.Error("Evicted() = false, want true")
+	}
+	if got := c.Stats().ItemEvictions; got != 2 {
+		t.Errorf("ItemEvictions = %d, want 2", got)
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+	c := NewCache[int](Config{MaxKeys: 2})
+
+	c.Add("a", 1)
+	c.Add("b", 1)
+	// touch a, so b is the least recently used key
+	c.Get("a")
+	c.Add("c", 1)
+
+	if got := c.Get("b"); len(got) != 0 {
+		t.Errorf("Get(b) = %v, want evicted", got)
+	}
+	if got := c.Get("a"); len(got) != 1 {
+		t.Errorf("Get(a) = %v, want kept", got)
+	}
+
+	stats := c.Stats()
+	if stats.Keys != 2 || stats.KeyEvictions != 1 {
+		t.Errorf("Stats() = %+v, want 2 keys and 1 key eviction", stats)
+	}
+}
+
+func TestCacheExpire(t *testing.T) {
+	c := NewCache[int](Config{TTL: 20 * time.Millisecond})
+
+	c.Add("done", 1)
+	c.Add("revived", 1)
+	c.Expire("done")
+	c.Expire("revived")
+	c.Add("revived", 2)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if got := c.Get("done"); len(got) != 0 {
+		t.Errorf("Get(done) = %v, want expired", got)
+	}
+	if got, want := c.Get("revived"), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Get(revived) = %v, want %v", got, want)
+	}
+	if got := c.Stats().Expirations; got != 1 {
+		t.Errorf("Expirations = %d, want 1", got)
+	}
+}
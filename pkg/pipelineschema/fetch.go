@@ -0,0 +1,124 @@
+package pipelineschema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nf-shard-orchestrator/pkg/cache"
+	"nf-shard-orchestrator/pkg/revision"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileName is the parameter schema nf-core style pipelines ship in the
+// root of their repository
+const FileName = "nextflow_schema.json"
+
+// ErrNotFound is returned for pipelines without a parameter schema
+var ErrNotFound = errors.New("pipeline has no " + FileName)
+
+// time allowed for fetching the schema of a pipeline
+const fetchTimeout = 30 * time.Second
+
+// Fetcher reads the parameter schema of a pipeline at a revision
+type Fetcher struct {
+	GitBinPath string
+	// Cache keeps the schemas fetched at a commit, which never change, nil
+	// fetches every time
+	Cache *cache.Cache[[]byte]
+}
+
+// Fetch returns the schema of the pipeline at revision, the default branch
+// when revision is empty. Local pipelines are read from disk, anything
+// else is fetched from its git remote.
+func (f *Fetcher) Fetch(ctx context.Context, pipelineURL string, rev string) ([]byte, error) {
+	if info, err := os.Stat(pipelineURL); err == nil && info.IsDir() {
+		data, err := os.ReadFile(filepath.Join(pipelineURL, FileName))
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return data, err
+	}
+
+	url, err := revision.RepositoryURL(pipelineURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Cache == nil || !revision.IsCommit(rev) {
+		return f.fetch(ctx, url, rev)
+	}
+
+	// a pipeline without a schema is cached as nil
+	key := url + "@" + rev
+	if cached := f.Cache.Get(key); len(cached) > 0 {
+		if cached[0] == nil {
+			return nil, ErrNotFound
+		}
+		return cached[0], nil
+	}
+
+	data, err := f.fetch(ctx, url, rev)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		f.Cache.Add(key, data)
+	}
+	return data, err
+}
+
+// fetch reads the schema at revision from the git remote url
+func (f *Fetcher) fetch(ctx context.Context, url string, rev string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "pipeline-schema-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ref := rev
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	// a shallow fetch without blobs only transfers the tree, git show
+	// then fetches the one blob it needs
+	_, err = f.git(ctx, dir, "init", "--quiet", "--bare")
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.git(ctx, dir, "fetch", "--quiet", "--depth", "1", "--filter", "blob:none", "--", url, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := f.git(ctx, dir, "ls-tree", "FETCH_HEAD", "--", FileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(tree) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return f.git(ctx, dir, "show", "FETCH_HEAD:"+FileName)
+}
+
+// git runs a git command in dir and returns its output
+func (f *Fetcher) git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, f.GitBinPath, args...)
+	cmd.Dir = dir
+	// never prompt for credentials of private repositories
+	cmd.Env = append(cmd.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return output, nil
+}
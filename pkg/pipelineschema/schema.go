@@ -0,0 +1,268 @@
+package pipelineschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// the schema is compiled from memory under this URL
+const schemaURL = "file:///" + FileName
+
+var (
+	// names listed in required and additionalProperties messages
+	quotedRegex  = regexp.MustCompile(`'([^']*)'`)
+	integerRegex = regexp.MustCompile(`^-?[0-9]+$`)
+	numberRegex  = regexp.MustCompile(`^-?[0-9]*\.?[0-9]+([eE][-+]?[0-9]+)?$`)
+)
+
+const undeclaredMessage = "parameter is not declared in the schema"
+
+// FieldError is a parameter that doesn't match the schema
+type FieldError struct {
+	Field   string
+	Message string
+	// Keyword is the schema keyword that failed, e.g. required or type
+	Keyword string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// property is a parameter declared in the schema
+type property struct {
+	Type       string
+	Default    any
+	HasDefault bool
+}
+
+// Schema is a compiled nextflow_schema.json
+type Schema struct {
+	schema     *jsonschema.Schema
+	properties map[string]property
+}
+
+// Parse compiles a parameter schema, references outside of the schema are
+// not loaded
+func Parse(data []byte) (*Schema, error) {
+	var raw map[string]any
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", FileName, err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("loading %s: external references are not supported", url)
+	}
+	err = compiler.AddResource(schemaURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", FileName, err)
+	}
+	schema, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", FileName, err)
+	}
+
+	return &Schema{schema: schema, properties: properties(raw)}, nil
+}
+
+// properties collects the parameters declared at the top level and in the
+// definitions nf-core schemas group them in
+func properties(raw map[string]any) map[string]property {
+	result := make(map[string]property)
+
+	add := func(schema any) {
+		object, _ := schema.(map[string]any)
+		props, _ := object["properties"].(map[string]any)
+		for name, value := range props {
+			prop, _ := value.(map[string]any)
+			typ, _ := prop["type"].(string)
+			def, hasDefault := prop["default"]
+			result[name] = property{Type: typ, Default: def, HasDefault: hasDefault}
+		}
+	}
+
+	for _, key := range []string{"definitions", "$defs"} {
+		definitions, _ := raw[key].(map[string]any)
+		for _, definition := range definitions {
+			add(definition)
+		}
+	}
+	add(raw)
+
+	return result
+}
+
+// Params returns the params nextflow sees for the command line args and
+// params file of a run. Args override the params file and their values are
+// converted like nextflow does, unless the schema declares a string.
+func (s *Schema) Params(args []string, params map[string]any) map[string]any {
+	result := make(map[string]any, len(params))
+	for key, value := range params {
+		result[key] = value
+	}
+
+	for i := 0; i < len(args); i++ {
+		name, ok := strings.CutPrefix(args[i], "--")
+		if !ok || name == "" {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(name, "=")
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			value, hasValue = args[i], true
+		}
+
+		if !hasValue {
+			// a flag is set to true
+			result[name] = true
+			continue
+		}
+		result[name] = s.convert(name, value)
+	}
+
+	return result
+}
+
+// convert returns the value of a command line param
+func (s *Schema) convert(name string, value string) any {
+	if s.properties[name].Type == "string" {
+		return value
+	}
+
+	switch {
+	case strings.EqualFold(value, "true"):
+		return true
+	case strings.EqualFold(value, "false"):
+		return false
+	case integerRegex.MatchString(value):
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	case numberRegex.MatchString(value):
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// Validate returns the params that don't match the schema, sorted by
+// field. Params missing from params take the default of the schema, the
+// pipeline config sets the same defaults.
+func (s *Schema) Validate(params map[string]any) ([]FieldError, error) {
+	withDefaults := make(map[string]any, len(params))
+	for name, prop := range s.properties {
+		if prop.HasDefault {
+			withDefaults[name] = prop.Default
+		}
+	}
+	for key, value := range params {
+		withDefaults[key] = value
+	}
+
+	// the validator only knows the types encoding/json decodes to
+	data, err := json.Marshal(withDefaults)
+	if err != nil {
+		return nil, fmt.Errorf("encoding params: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var instance any
+	err = decoder.Decode(&instance)
+	if err != nil {
+		return nil, fmt.Errorf("decoding params: %w", err)
+	}
+
+	err = s.schema.Validate(instance)
+	var validationErr *jsonschema.ValidationError
+	if errors.As(err, &validationErr) {
+		return fieldErrors(validationErr), nil
+	}
+	return nil, err
+}
+
+// fieldErrors flattens the causes of a validation error into an error per
+// field
+func fieldErrors(err *jsonschema.ValidationError) []FieldError {
+	seen := make(map[FieldError]bool)
+	var result []FieldError
+
+	add := func(e FieldError) {
+		if !seen[e] {
+			seen[e] = true
+			result = append(result, e)
+		}
+	}
+
+	var walk func(err *jsonschema.ValidationError)
+	walk = func(err *jsonschema.ValidationError) {
+		if len(err.Causes) > 0 {
+			for _, cause := range err.Causes {
+				walk(cause)
+			}
+			return
+		}
+
+		keyword := err.KeywordLocation[strings.LastIndex(err.KeywordLocation, "/")+1:]
+		field := instanceField(err.InstanceLocation)
+
+		switch keyword {
+		case "unevaluatedProperties":
+			add(FieldError{Field: field, Message: undeclaredMessage, Keyword: keyword})
+		case "required", "additionalProperties":
+			message := "required parameter is missing"
+			if keyword == "additionalProperties" {
+				message = undeclaredMessage
+			}
+			for _, match := range quotedRegex.FindAllStringSubmatch(err.Message, -1) {
+				name := match[1]
+				if field != "" {
+					name = field + "." + name
+				}
+				add(FieldError{Field: name, Message: message, Keyword: keyword})
+			}
+		default:
+			add(FieldError{Field: field, Message: err.Message, Keyword: keyword})
+		}
+	}
+	walk(err)
+
+	// properties of failing subschemas count as unevaluated, the other
+	// error of the field explains it
+	failed := make(map[string]bool)
+	for _, e := range result {
+		if e.Keyword != "unevaluatedProperties" {
+			failed[e.Field] = true
+		}
+	}
+	result = slices.DeleteFunc(result, func(e FieldError) bool {
+		return e.Keyword == "unevaluatedProperties" && failed[e.Field]
+	})
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Field < result[j].Field
+	})
+	return result
+}
+
+// instanceField turns the JSON pointer of a value into a dotted field name
+func instanceField(location string) string {
+	parts := strings.Split(strings.TrimPrefix(location, "/"), "/")
+	for i, part := range parts {
+		parts[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+	}
+	return strings.Join(parts, ".")
+}
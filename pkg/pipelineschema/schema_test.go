@@ -0,0 +1,290 @@
+package pipelineschema
+
+import (
+	"context"
+	"errors"
+	"nf-shard-orchestrator/pkg/cache"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// trimmed down from an nf-core pipeline
+const testSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema",
+  "$id": "https://raw.githubusercontent.com/nf-core/demo/master/nextflow_schema.json",
+  "title": "nf-core/demo pipeline parameters",
+  "type": "object",
+  "definitions": {
+    "input_output_options": {
+      "title": "Input/output options",
+      "type": "object",
+      "fa_icon": "fas fa-terminal",
+      "required": ["input", "outdir"],
+      "properties": {
+        "input": {"type": "string", "format": "file-path", "exists": true, "pattern": "^\\S+\\.csv$"},
+        "outdir": {"type": "string", "format": "directory-path"},
+        "genome": {"type": "string", "enum": ["GRCh38", "GRCm39"]}
+      }
+    },
+    "max_job_request_options": {
+      "type": "object",
+      "properties": {
+        "max_cpus": {"type": "integer", "default": 16, "minimum": 1},
+        "skip_qc": {"type": "boolean"},
+        "sample_id": {"type": "string"},
+        "fraction": {"type": "number"}
+      }
+    }
+  },
+  "allOf": [
+    {"$ref": "#/definitions/input_output_options"},
+    {"$ref": "#/definitions/max_job_request_options"}
+  ]
+}`
+
+func parse(t *testing.T, schema string) *Schema {
+	t.Helper()
+
+	s, err := Parse([]byte(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParams(t *testing.T) {
+	s := parse(t, testSchema)
+
+	params := s.Params([]string{
+		"-profile", "docker",
+		"--input", "samples.csv",
+		"--max_cpus", "8",
+		"--skip_qc",
+		"--sample_id", "0042",
+		"--fraction=0.5",
+		"--unknown", "TRUE",
+		"-resume",
+	}, map[string]any{"outdir": "results", "max_cpus": 4})
+
+	want := map[string]any{
+		"input":     "samples.csv",
+		"outdir":    "results",
+		"max_cpus":  int64(8),
+		"skip_qc":   true,
+		"sample_id": "0042",
+		"fraction":  0.5,
+		"unknown":   true,
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("params = %#v, want %#v", params, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := parse(t, testSchema)
+
+	tests := []struct {
+		name   string
+		params map[string]any
+		want   []FieldError
+	}{
+		{
+			name:   "valid",
+			params: map[string]any{"input": "samples.csv", "outdir": "results", "max_cpus": 4, "genome": "GRCh38"},
+		},
+		{
+			name:   "missing required",
+			params: map[string]any{"genome": "GRCh38"},
+			want: []FieldError{
+				{Field: "input", Message: "required parameter is missing", Keyword: "required"},
+				{Field: "outdir", Message: "required parameter is missing", Keyword: "required"},
+			},
+		},
+		{
+			name:   "wrong values",
+			params: map[string]any{"input": "samples.tsv", "outdir": "results", "max_cpus": "many", "genome": "hg19", "skip_qc": "yes"},
+			want: []FieldError{
+				{Field: "genome", Message: `value must be one of "GRCh38", "GRCm39"`, Keyword: "enum"},
+				{Field: "input", Message: `does not match pattern '^\\S+\\.csv$'`, Keyword: "pattern"},
+				{Field: "max_cpus", Message: "expected integer, but got string", Keyword: "type"},
+				{Field: "skip_qc", Message: "expected boolean, but got string", Keyword: "type"},
+			},
+		},
+		{
+			name:   "default checked",
+			params: map[string]any{"input": "samples.csv", "outdir": "results", "max_cpus": 0},
+			want: []FieldError{
+				{Field: "max_cpus", Message: "must be >= 1 but found 0", Keyword: "minimum"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Validate(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDraft2020(t *testing.T) {
+	s := parse(t, `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "$defs": {
+    "options": {
+      "properties": {"depth": {"type": "integer"}},
+      "required": ["depth"]
+    }
+  },
+  "allOf": [{"$ref": "#/$defs/options"}],
+  "unevaluatedProperties": false
+}`)
+
+	tests := []struct {
+		args []string
+		want []FieldError
+	}{
+		{[]string{"--depth", "3"}, nil},
+		{[]string{"--depth", "2.5"}, []FieldError{{Field: "depth", Message: "expected integer, but got number", Keyword: "type"}}},
+		{[]string{"--extra", "x"}, []FieldError{
+			{Field: "depth", Message: "required parameter is missing", Keyword: "required"},
+			{Field: "extra", Message: "parameter is not declared in the schema", Keyword: "unevaluatedProperties"},
+		}},
+		{[]string{"--depth", "3", "--extra", "x"}, []FieldError{{Field: "extra", Message: "parameter is not declared in the schema", Keyword: "unevaluatedProperties"}}},
+	}
+
+	for _, tt := range tests {
+		got, err := s.Validate(s.Params(tt.args, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: errors = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, schema := range []string{
+		`not json`,
+		`{"type": "object", "properties": {"a": {"type": 3}}}`,
+		`{"allOf": [{"$ref": "https://example.com/other.json"}]}`,
+	} {
+		if _, err := Parse([]byte(schema)); err == nil {
+			t.Errorf("expected %s to be invalid", schema)
+		}
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestFetch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	git(t, repo, "init", "--quiet", "--initial-branch=main")
+	git(t, repo, "commit", "--quiet", "--allow-empty", "-m", "no schema")
+	git(t, repo, "tag", "v1")
+	err := os.WriteFile(filepath.Join(repo, FileName), []byte(testSchema), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	git(t, repo, "add", FileName)
+	git(t, repo, "commit", "--quiet", "-m", "add schema")
+
+	f := &Fetcher{GitBinPath: "git"}
+	ctx := context.Background()
+
+	for _, pipeline := range []string{"file://" + repo, repo} {
+		data, err := f.Fetch(ctx, pipeline, "")
+		if err != nil {
+			t.Fatalf("%s: %v", pipeline, err)
+		}
+		if string(data) != testSchema {
+			t.Errorf("%s: unexpected schema %q", pipeline, data)
+		}
+	}
+
+	_, err = f.Fetch(ctx, "file://"+repo, "v1")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound at v1, got %v", err)
+	}
+
+	_, err = f.Fetch(ctx, "file://"+repo, "missing")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a fetch error for a missing revision, got %v", err)
+	}
+}
+
+func TestFetchCache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	git(t, repo, "init", "--quiet", "--initial-branch=main")
+	git(t, repo, "commit", "--quiet", "--allow-empty", "-m", "no schema")
+	empty := git(t, repo, "rev-parse", "HEAD")
+	err := os.WriteFile(filepath.Join(repo, FileName), []byte(testSchema), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	git(t, repo, "add", FileName)
+	git(t, repo, "commit", "--quiet", "-m", "add schema")
+	commit := git(t, repo, "rev-parse", "HEAD")
+
+	f := &Fetcher{GitBinPath: "git", Cache: cache.NewCache[[]byte](cache.Config{MaxItemsPerKey: 1})}
+	ctx := context.Background()
+	url := "file://" + repo
+
+	_, err = f.Fetch(ctx, url, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Fetch(ctx, url, empty)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// commits are served from the cache once fetched
+	err = os.RemoveAll(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.Fetch(ctx, url, commit)
+	if err != nil || string(data) != testSchema {
+		t.Errorf("Fetch() = %q, %v, want cached schema", data, err)
+	}
+	_, err = f.Fetch(ctx, url, empty)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected cached ErrNotFound, got %v", err)
+	}
+	_, err = f.Fetch(ctx, url, "main")
+	if err == nil {
+		t.Error("expected branches not to be cached")
+	}
+}
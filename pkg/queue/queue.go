@@ -0,0 +1,268 @@
+package queue
+
+import (
+	"sync"
+)
+
+// Limits caps the number of active runs, zero means unlimited
+type Limits struct {
+	MaxRuns            int
+	MaxRunsPerExecutor map[string]int
+	MaxRunsPerUser     int
+}
+
+// Entry is a run waiting for or holding a slot, Value carries whatever is
+// needed to launch it
+type Entry[T any] struct {
+	RunName  string
+	Executor string
+	// User is optional, runs without a user are only subject to the
+	// global and executor limits
+	User string
+	// Priority orders the waiting runs, higher first
+	Priority int
+	Value    T
+
+	// arrival order among runs of the same priority
+	seq uint64
+}
+
+type Stats struct {
+	Active  int
+	Waiting int
+}
+
+// Queue admits runs while they fit the limits and keeps the others by
+// priority and arrival order until slots are released
+type Queue[T any] struct {
+	mu      sync.Mutex
+	limits  Limits
+	waiting []Entry[T]
+	active  map[string]Entry[T]
+	seq     uint64
+}
+
+func New[T any](limits Limits) *Queue[T] {
+	return &Queue[T]{
+		limits: limits,
+		active: make(map[string]Entry[T]),
+	}
+}
+
+// fits reports whether e can be admitted, must be called with the lock held
+func (q *Queue[T]) fits(e Entry[T]) bool {
+	if q.limits.MaxRuns > 0 && len(q.active) >= q.limits.MaxRuns {
+		return false
+	}
+
+	maxExecutor := q.limits.MaxRunsPerExecutor[e.Executor]
+	maxUser := q.limits.MaxRunsPerUser
+	if e.User == "" {
+		maxUser = 0
+	}
+	if maxExecutor == 0 && maxUser == 0 {
+		return true
+	}
+
+	executorRuns, userRuns := 0, 0
+	for _, a := range q.active {
+		if a.Executor == e.Executor {
+			executorRuns++
+		}
+		if a.User == e.User {
+			userRuns++
+		}
+	}
+
+	if maxExecutor > 0 && executorRuns >= maxExecutor {
+		return false
+	}
+	if maxUser > 0 && userRuns >= maxUser {
+		return false
+	}
+	return true
+}
+
+// Submit admits e if it fits the limits and returns 0, otherwise e is
+// queued and its 1-based position returned. Waiting entries never fit,
+// so an admitted entry doesn't overtake any that could have started.
+func (q *Queue[T]) Submit(e Entry[T]) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	e.seq = q.seq
+
+	if q.fits(e) {
+		q.active[e.RunName] = e
+		return 0
+	}
+
+	return q.insert(e)
+}
+
+// insert adds e to the waiting runs behind those of the same or higher
+// priority that arrived before it and returns its 1-based position
+func (q *Queue[T]) insert(e Entry[T]) int {
+	i := len(q.waiting)
+	for i > 0 {
+		prev := q.waiting[i-1]
+		if prev.Priority > e.Priority || (prev.Priority == e.Priority && prev.seq < e.seq) {
+			break
+		}
+		i--
+	}
+
+	q.waiting = append(q.waiting, Entry[T]{})
+	copy(q.waiting[i+1:], q.waiting[i:])
+	q.waiting[i] = e
+	return i + 1
+}
+
+// Track marks e as active without checking the limits, for runs started
+// before the queue existed such as those of a previous worker
+func (q *Queue[T]) Track(e Entry[T]) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	e.seq = q.seq
+	q.active[e.RunName] = e
+}
+
+// Release frees the slot of a finished run and returns the waiting
+// entries admitted in its place, the caller is responsible for starting them
+func (q *Queue[T]) Release(runName string) []Entry[T] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.active[runName]; !ok {
+		q.remove(runName)
+		return nil
+	}
+	delete(q.active, runName)
+
+	return q.admit()
+}
+
+// Requeue moves an active run back to the waiting runs with a new value,
+// keeping its place among runs of the same priority, and returns the
+// entries admitted in its place
+func (q *Queue[T]) Requeue(runName string, value T) []Entry[T] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.active[runName]
+	if !ok {
+		return nil
+	}
+	delete(q.active, runName)
+
+	e.Value = value
+	q.insert(e)
+
+	return q.admit()
+}
+
+// Victim returns the active run to preempt so that the waiting run fits:
+// the eligible run of the lowest priority below that of the waiting run,
+// the most recently submitted one among equals as it has the least work
+// to lose.
+func (q *Queue[T]) Victim(runName string, eligible func(Entry[T]) bool) (Entry[T], bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var waiting *Entry[T]
+	for i := range q.waiting {
+		if q.waiting[i].RunName == runName {
+			waiting = &q.waiting[i]
+		}
+	}
+	if waiting == nil {
+		return Entry[T]{}, false
+	}
+
+	var victim Entry[T]
+	found := false
+	for name, a := range q.active {
+		if a.Priority >= waiting.Priority || !eligible(a) {
+			continue
+		}
+		if found && (a.Priority > victim.Priority || (a.Priority == victim.Priority && a.seq < victim.seq)) {
+			continue
+		}
+
+		// only runs holding a slot the waiting run needs help
+		delete(q.active, name)
+		fits := q.fits(*waiting)
+		q.active[name] = a
+		if fits {
+			victim = a
+			found = true
+		}
+	}
+
+	return victim, found
+}
+
+// admit moves every waiting entry that fits to active, by priority and
+// arrival order.
+// Entries blocked by their executor or user limit don't hold up others.
+func (q *Queue[T]) admit() []Entry[T] {
+	var admitted []Entry[T]
+
+	waiting := q.waiting[:0]
+	for _, e := range q.waiting {
+		if q.fits(e) {
+			q.active[e.RunName] = e
+			admitted = append(admitted, e)
+			continue
+		}
+		waiting = append(waiting, e)
+	}
+	q.waiting = waiting
+
+	return admitted
+}
+
+// Remove drops a waiting entry and reports whether it was queued
+func (q *Queue[T]) Remove(runName string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.remove(runName)
+}
+
+func (q *Queue[T]) remove(runName string) bool {
+	for i, e := range q.waiting {
+		if e.RunName == runName {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Position returns the 1-based position of a waiting run, 0 if the run
+// is not queued
+func (q *Queue[T]) Position(runName string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, e := range q.waiting {
+		if e.RunName == runName {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (q *Queue[T]) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Stats{
+		Active:  len(q.active),
+		Waiting: len(q.waiting),
+	}
+}
@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+)
+
+func names(entries []Entry[int]) []string {
+	result := []string{}
+	for _, e := range entries {
+		result = append(result, e.RunName)
+	}
+	return result
+}
+
+func TestGlobalLimit(t *testing.T) {
+	q := New[int](Limits{MaxRuns: 2})
+
+	for i, name := range []string{"a", "b", "c", "d"} {
+		position := q.Submit(Entry[int]{RunName: name, Executor: "local"})
+		want := max(0, i-1)
+		if position != want {
+			t.Errorf("%s: expected position %d, got %d", name, want, position)
+		}
+	}
+
+	if q.Position("d") != 2 {
+		t.Errorf("expected d at position 2, got %d", q.Position("d"))
+	}
+
+	admitted := q.Release("a")
+	if !reflect.DeepEqual(names(admitted), []string{"c"}) {
+		t.Fatalf("expected c to be admitted, got %v", names(admitted))
+	}
+	if q.Position("d") != 1 {
+		t.Errorf("expected d at position 1, got %d", q.Position("d"))
+	}
+
+	if stats := q.Stats(); stats != (Stats{Active: 2, Waiting: 1}) {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestExecutorAndUserLimits(t *testing.T) {
+	q := New[int](Limits{
+		MaxRunsPerExecutor: map[string]int{"local": 1},
+		MaxRunsPerUser:     2,
+	})
+
+	submit := func(name, executor, user string) int {
+		return q.Submit(Entry[int]{RunName: name, Executor: executor, User: user})
+	}
+
+	if submit("local-1", "local", "ann") != 0 {
+		t.Fatal("expected local-1 to be admitted")
+	}
+	if submit("local-2", "local", "bob") != 1 {
+		t.Fatal("expected local-2 to be queued by the executor limit")
+	}
+	// blocked runs of another executor don't hold up this one
+	if submit("float-1", "float", "ann") != 0 {
+		t.Fatal("expected float-1 to be admitted")
+	}
+	if submit("float-2", "float", "ann") != 2 {
+		t.Fatal("expected float-2 to be queued by the user limit")
+	}
+	// runs without a user are not subject to the user limit
+	if submit("float-3", "float", "") != 0 {
+		t.Fatal("expected float-3 to be admitted")
+	}
+
+	admitted := q.Release("local-1")
+	if !reflect.DeepEqual(names(admitted), []string{"local-2", "float-2"}) {
+		t.Fatalf("expected local-2 and float-2 to be admitted, got %v", names(admitted))
+	}
+}
+
+func TestRemove(t *testing.T) {
+	q := New[int](Limits{MaxRuns: 1})
+	q.Submit(Entry[int]{RunName: "a"})
+	q.Submit(Entry[int]{RunName: "b"})
+	q.Submit(Entry[int]{RunName: "c"})
+
+	if !q.Remove("b") {
+		t.Fatal("expected b to be removed")
+	}
+	if q.Remove("a") {
+		t.Fatal("expected active run not to be removed")
+	}
+
+	// releasing a run that is not active drops it from the queue
+	if admitted := q.Release("c"); len(admitted) != 0 {
+		t.Fatalf("expected nothing to be admitted, got %v", names(admitted))
+	}
+	if stats := q.Stats(); stats != (Stats{Active: 1}) {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	q := New[int](Limits{MaxRuns: 1})
+	q.Track(Entry[int]{RunName: "previous"})
+
+	if q.Submit(Entry[int]{RunName: "a"}) != 1 {
+		t.Fatal("expected tracked run to take the slot")
+	}
+	if admitted := q.Release("previous"); !reflect.DeepEqual(names(admitted), []string{"a"}) {
+		t.Fatalf("expected a to be admitted, got %v", names(admitted))
+	}
+}
+
+func TestPriority(t *testing.T) {
+	q := New[int](Limits{MaxRuns: 1})
+	q.Submit(Entry[int]{RunName: "running"})
+
+	for _, e := range []Entry[int]{
+		{RunName: "normal-1", Priority: 1},
+		{RunName: "low", Priority: 0},
+		{RunName: "high", Priority: 2},
+		{RunName: "normal-2", Priority: 1},
+	} {
+		q.Submit(e)
+	}
+
+	if q.Position("high") != 1 || q.Position("normal-1") != 2 || q.Position("normal-2") != 3 || q.Position("low") != 4 {
+		t.Errorf("unexpected order: high %d, normal-1 %d, normal-2 %d, low %d",
+			q.Position("high"), q.Position("normal-1"), q.Position("normal-2"), q.Position("low"))
+	}
+
+	admitted := q.Release("running")
+	if !reflect.DeepEqual(names(admitted), []string{"high"}) {
+		t.Fatalf("expected high to be admitted, got %v", names(admitted))
+	}
+}
+
+func TestPreemption(t *testing.T) {
+	q := New[int](Limits{MaxRuns: 3, MaxRunsPerExecutor: map[string]int{"local": 2}})
+	q.Submit(Entry[int]{RunName: "local-low", Executor: "local", Priority: 0})
+	q.Submit(Entry[int]{RunName: "local-normal", Executor: "local", Priority: 1})
+	q.Submit(Entry[int]{RunName: "float-low", Executor: "float", Priority: 0})
+	q.Submit(Entry[int]{RunName: "critical", Executor: "local", Priority: 3})
+
+	all := func(Entry[int]) bool { return true }
+
+	// float-low is newer but its slot doesn't help a local run
+	victim, ok := q.Victim("critical", all)
+	if !ok || victim.RunName != "local-low" {
+		t.Fatalf("expected local-low to be preempted, got %q %v", victim.RunName, ok)
+	}
+
+	_, ok = q.Victim("critical", func(e Entry[int]) bool { return e.RunName != "local-low" && e.RunName != "local-normal" })
+	if ok {
+		t.Fatal("expected no victim without eligible local runs")
+	}
+
+	admitted := q.Requeue("local-low", 42)
+	if !reflect.DeepEqual(names(admitted), []string{"critical"}) {
+		t.Fatalf("expected critical to be admitted, got %v", names(admitted))
+	}
+	if q.Position("local-low") != 1 {
+		t.Errorf("expected local-low to wait at position 1, got %d", q.Position("local-low"))
+	}
+
+	admitted = q.Release("local-normal")
+	if len(admitted) != 1 || admitted[0].RunName != "local-low" || admitted[0].Value != 42 {
+		t.Fatalf("expected requeued local-low to be admitted with its new value, got %+v", admitted)
+	}
+}
@@ -0,0 +1,170 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Classifier reports whether a failed attempt is worth retrying
+type Classifier func(err error) bool
+
+// Policy controls how often and how quickly a failed operation is retried
+type Policy struct {
+	// MaxAttempts includes the first attempt, values below 2 disable retries
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every
+	// following one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable defaults to Transient
+	Retryable Classifier
+}
+
+// Policies holds a policy per executor and the default for all others
+type Policies struct {
+	Default   Policy
+	Executors map[string]Policy
+}
+
+func (p Policies) For(executor string) Policy {
+	if policy, ok := p.Executors[executor]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// Delay returns the backoff after the given failed attempt
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+func (p Policy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if p.Retryable == nil {
+		return Transient(err)
+	}
+	return p.Retryable(err)
+}
+
+// Attempt describes the outcome of one call of the retried operation
+type Attempt struct {
+	// Number is 1-based
+	Number int
+	Err    error
+	// Retry is set when the operation is called again after Delay
+	Retry bool
+	Delay time.Duration
+}
+
+// Do calls fn until it succeeds, returns an error the policy does not
+// retry, the attempts are used up or ctx is done. observe, if set, is called
+// after every attempt. The error of the last attempt is returned.
+func Do(ctx context.Context, p Policy, fn func(attempt int) error, observe func(Attempt)) error {
+	for number := 1; ; number++ {
+		err := fn(number)
+
+		a := Attempt{Number: number, Err: err}
+		if err != nil && number < p.MaxAttempts && p.retryable(err) {
+			a.Retry = true
+			a.Delay = p.Delay(number)
+		}
+		if observe != nil {
+			observe(a)
+		}
+		if !a.Retry {
+			return err
+		}
+
+		timer := time.NewTimer(a.Delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// transientMessages are lower case fragments of errors reported by
+// nextflow, git and the executor CLIs for failures that tend to go away
+var transientMessages = []string{
+	"connection reset",
+	"connection refused",
+	"connection timed out",
+	"i/o timeout",
+	"tls handshake timeout",
+	"no such host",
+	"temporary failure in name resolution",
+	"network is unreachable",
+	"unexpected eof",
+	"too many requests",
+	"rate limit",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+	// corrupted nextflow asset cache, removed before every launch
+	"git repository config file",
+	"packfile",
+	"cannot find a component",
+}
+
+// Transient reports network errors and errors whose message matches a
+// known transient failure
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	return containsAny(err.Error(), transientMessages)
+}
+
+// Matching returns a classifier retrying the errors matched by base or
+// containing one of the given messages, compared case-insensitively
+func Matching(base Classifier, messages ...string) Classifier {
+	lower := make([]string, len(messages))
+	for i, m := range messages {
+		lower[i] = strings.ToLower(m)
+	}
+
+	return func(err error) bool {
+		if base != nil && base(err) {
+			return true
+		}
+		return err != nil && containsAny(err.Error(), lower)
+	}
+}
+
+func containsAny(msg string, fragments []string) bool {
+	msg = strings.ToLower(msg)
+	for _, f := range fragments {
+		if strings.Contains(msg, f) {
+			return true
+		}
+	}
+	return false
+}
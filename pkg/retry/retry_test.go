@@ -0,0 +1,101 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	transient := errors.New("read: connection reset by peer")
+	policy := Policy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	tests := []struct {
+		name     string
+		errs     []error
+		wantErr  error
+		wantRuns int
+	}{
+		{"succeeds first time", []error{nil}, nil, 1},
+		{"recovers from transient errors", []error{transient, transient, nil}, nil, 3},
+		{"gives up after max attempts", []error{transient, transient, transient, nil}, transient, 3},
+		{"does not retry permanent errors", []error{errors.New("invalid pipeline"), nil}, errors.New("invalid pipeline"), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := 0
+			var observed []Attempt
+			err := Do(context.Background(), policy, func(attempt int) error {
+				runs++
+				if attempt != runs {
+					t.Errorf("expected attempt %d, got %d", runs, attempt)
+				}
+				return tt.errs[attempt-1]
+			}, func(a Attempt) {
+				observed = append(observed, a)
+			})
+
+			if fmt.Sprint(err) != fmt.Sprint(tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if runs != tt.wantRuns || len(observed) != tt.wantRuns {
+				t.Errorf("expected %d attempts, ran %d and observed %d", tt.wantRuns, runs, len(observed))
+			}
+			if last := observed[len(observed)-1]; last.Retry {
+				t.Errorf("expected last attempt not to be retried: %+v", last)
+			}
+		})
+	}
+}
+
+func TestDoStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{MaxAttempts: 5, Backoff: time.Hour}
+
+	runs := 0
+	err := Do(ctx, policy, func(int) error {
+		runs++
+		return errors.New("i/o timeout")
+	}, func(Attempt) { cancel() })
+
+	if err == nil || runs != 1 {
+		t.Fatalf("expected a single failed attempt, got %d runs and %v", runs, err)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	policy := Policy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := policy.Delay(attempt); got != want {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, want, got)
+		}
+	}
+}
+
+func TestClassifiers(t *testing.T) {
+	float := Matching(Transient, "float login failed")
+
+	tests := []struct {
+		err        error
+		transient  bool
+		floatRetry bool
+	}{
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false, false},
+		{errors.New("fatal: Can't find git repository config file"), true, true},
+		{errors.New("float login failed: exit status 1: Unauthorized"), false, true},
+		{errors.New("Unknown project `nf-core/nope`"), false, false},
+	}
+
+	for _, tt := range tests {
+		if got := Transient(tt.err); got != tt.transient {
+			t.Errorf("Transient(%q) = %v, want %v", tt.err, got, tt.transient)
+		}
+		if got := float(tt.err); got != tt.floatRetry {
+			t.Errorf("float classifier(%q) = %v, want %v", tt.err, got, tt.floatRetry)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package revision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotRepository is returned for pipelines that are not fetched from a
+	// git remote, such as local paths
+	ErrNotRepository = errors.New("pipeline is not a git repository")
+	ErrUnresolved    = errors.New("revision not found")
+)
+
+// time allowed for listing the refs of a remote
+const lsRemoteTimeout = 30 * time.Second
+
+var (
+	shaRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// owner/repository, nextflow pulls these from GitHub
+	shorthandRegex = regexp.MustCompile(`^[a-zA-Z0-9][-_.a-zA-Z0-9]*/[-_.a-zA-Z0-9]+$`)
+)
+
+// IsCommit reports whether revision is a full commit SHA
+func IsCommit(revision string) bool {
+	return shaRegex.MatchString(revision)
+}
+
+// RepositoryURL returns the git remote nextflow pulls a pipeline from
+func RepositoryURL(pipelineURL string) (string, error) {
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git@", "file://"} {
+		if strings.HasPrefix(pipelineURL, scheme) {
+			return pipelineURL, nil
+		}
+	}
+	if shorthandRegex.MatchString(pipelineURL) {
+		return "https://github.com/" + pipelineURL, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrNotRepository, pipelineURL)
+}
+
+// Resolver resolves branches and tags of pipeline repositories to the
+// commit they point to
+type Resolver struct {
+	GitBinPath string
+}
+
+// Resolve returns the commit SHA of the revision of a pipeline, the
+// default branch when revision is empty
+func (r *Resolver) Resolve(ctx context.Context, pipelineURL string, revision string) (string, error) {
+	if IsCommit(revision) {
+		return revision, nil
+	}
+
+	url, err := RepositoryURL(pipelineURL)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lsRemoteTimeout)
+	defer cancel()
+
+	ref := revision
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	cmd := exec.CommandContext(ctx, r.GitBinPath, "ls-remote", "--", url, ref, ref+"^{}")
+	// never prompt for credentials of private repositories
+	cmd.Env = append(cmd.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("git ls-remote %s failed: %w: %s", url, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git ls-remote %s failed: %w", url, err)
+	}
+
+	sha, ok := parseLsRemote(string(output), ref)
+	if !ok {
+		return "", fmt.Errorf("%w: %s in %s", ErrUnresolved, ref, url)
+	}
+	return sha, nil
+}
+
+// parseLsRemote picks the commit of ref from the output of git ls-remote.
+// Tags are preferred over branches of the same name and annotated tags
+// are peeled to their commit.
+func parseLsRemote(output string, ref string) (string, bool) {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		sha, name, found := strings.Cut(strings.TrimSpace(line), "\t")
+		if found && shaRegex.MatchString(sha) {
+			refs[name] = sha
+		}
+	}
+
+	for _, name := range []string{
+		ref,
+		"refs/tags/" + ref + "^{}",
+		"refs/tags/" + ref,
+		"refs/heads/" + ref,
+	} {
+		if sha, ok := refs[name]; ok {
+			return sha, true
+		}
+	}
+	return "", false
+}
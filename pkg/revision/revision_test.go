@@ -0,0 +1,102 @@
+package revision
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepositoryURL(t *testing.T) {
+	tests := []struct {
+		pipelineURL string
+		want        string
+		wantErr     error
+	}{
+		{"nf-core/rnaseq", "https://github.com/nf-core/rnaseq", nil},
+		{"https://gitlab.com/acme/qc-pipeline", "https://gitlab.com/acme/qc-pipeline", nil},
+		{"git@github.com:acme/private.git", "git@github.com:acme/private.git", nil},
+		{"/data/pipelines/qc", "", ErrNotRepository},
+		{"./main.nf", "", ErrNotRepository},
+		{"--upload-pack=touch /tmp/pwned", "", ErrNotRepository},
+	}
+
+	for _, tt := range tests {
+		got, err := RepositoryURL(tt.pipelineURL)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("RepositoryURL(%q) = %q, %v, want %q, %v", tt.pipelineURL, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseLsRemote(t *testing.T) {
+	output := strings.Join([]string{
+		"1111111111111111111111111111111111111111\tHEAD",
+		"2222222222222222222222222222222222222222\trefs/heads/dev",
+		"3333333333333333333333333333333333333333\trefs/heads/feature/dev",
+		"4444444444444444444444444444444444444444\trefs/tags/3.14.0",
+		"5555555555555555555555555555555555555555\trefs/tags/3.14.0^{}",
+		"6666666666666666666666666666666666666666\trefs/tags/dev",
+	}, "\n")
+
+	tests := []struct {
+		ref  string
+		want string
+		ok   bool
+	}{
+		{"HEAD", "1111111111111111111111111111111111111111", true},
+		{"3.14.0", "5555555555555555555555555555555555555555", true},
+		{"dev", "6666666666666666666666666666666666666666", true},
+		{"refs/heads/dev", "2222222222222222222222222222222222222222", true},
+		{"feature", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseLsRemote(output, tt.ref)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseLsRemote(%q) = %q, %v, want %q, %v", tt.ref, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestResolve(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	git(t, dir, "init", "-q", "-b", "main")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "first")
+	first := git(t, dir, "rev-parse", "HEAD")
+	git(t, dir, "tag", "-a", "1.0.0", "-m", "release")
+	git(t, dir, "commit", "-q", "--allow-empty", "-m", "second")
+	second := git(t, dir, "rev-parse", "HEAD")
+
+	r := &Resolver{GitBinPath: "git"}
+	url := "file://" + filepath.ToSlash(dir)
+
+	for revision, want := range map[string]string{"": second, "main": second, "1.0.0": first, first: first} {
+		got, err := r.Resolve(context.Background(), url, revision)
+		if err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", revision, got, err, want)
+		}
+	}
+
+	_, err := r.Resolve(context.Background(), url, "missing")
+	if !errors.Is(err, ErrUnresolved) {
+		t.Errorf("Resolve() of missing revision error = %v, want %v", err, ErrUnresolved)
+	}
+}
@@ -70,8 +70,13 @@ plugins {
     id 'nf-float'
 }
 
+EOF
+
+# Appends the config override of the run, written verbatim.
 SHARD_CONFIG_OVERRIDE
 
+cat >> mmc.config << EOF
+
 // Directories for Nextflow execution.
 workDir = '${workDir}'
 launchDir = '${workDir}'
@@ -110,10 +115,14 @@ EOT
 # aws s3 cp s3://nextflow-input/samplesheet.csv .
 # aws s3 cp s3://nextflow-input/scripts/params.yml .
 
+# ---- Pipeline Parameters ----
+# Writes the params of the run passed to nextflow with -params-file, if any.
+SHARD_PARAMS_FILE
+
 # ---- Nextflow Command Setup ----
 # Important: The -c option appends the mmc config file and soft overrides the nextflow configuration.
 
-# Assembles the Nextflow command with all necessary options and parameters.
+# Assembles the Nextflow command with all necessary options and parameters into the nextflow_command array.
 SHARD_NEXTFLOW_COMMAND
 
 # ---------------------------------------------
@@ -151,7 +160,7 @@ chmod +x ./tag_nextflow_head.sh
 ./tag_nextflow_head.sh &
 
 # Start Nextflow run
-$nextflow_command
+"${nextflow_command[@]}"
 
 if [[ $? -ne 0 ]]; then
   echo $(date): "Nextflow command failed."
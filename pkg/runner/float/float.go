@@ -3,16 +3,16 @@ package float
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log/slog"
-	"nf-shard-orchestrator/graph/model"
-	"nf-shard-orchestrator/pkg/cache"
 	"nf-shard-orchestrator/pkg/runner"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
@@ -29,8 +29,11 @@ var fileTransientJFSAWS string
 //go:embed config/hostTerminate_AWS.sh
 var fileHostTerminateAWS string
 
-const configOverrideNeedle = "SHARD_CONFIG_OVERRIDE"
-const configNextflowCmdNeedle = "SHARD_NEXTFLOW_COMMAND"
+const (
+	stopAttempts   = 3
+	stopRetryDelay = 2 * time.Second
+	stopTimeout    = time.Minute
+)
 
 type Config struct {
 	Logger          *slog.Logger
@@ -39,26 +42,24 @@ type Config struct {
 	NextflowBinPath string
 	Js              jetstream.JetStream
 	Nc              *nats.Conn
-	LogCache        *cache.Cache[model.Log]
+	PollInterval    time.Duration
 }
 
 type Service struct {
-	config   Config
-	Wg       *sync.WaitGroup
-	Logger   *slog.Logger
-	Js       jetstream.JetStream
-	Nc       *nats.Conn
-	LogCache *cache.Cache[model.Log]
+	config Config
+	Wg     *sync.WaitGroup
+	Logger *slog.Logger
+	Js     jetstream.JetStream
+	Nc     *nats.Conn
 }
 
 func NewRunner(c Config) *Service {
 	return &Service{
-		config:   c,
-		Wg:       c.Wg,
-		Logger:   c.Logger,
-		Js:       c.Js,
-		Nc:       c.Nc,
-		LogCache: c.LogCache,
+		config: c,
+		Wg:     c.Wg,
+		Logger: c.Logger,
+		Js:     c.Js,
+		Nc:     c.Nc,
 	}
 }
 
@@ -68,28 +69,30 @@ func (s *Service) auth() error {
 	address := os.Getenv("FLOAT_ADDRESS")
 	args := []string{"login", "-a", address, "-u", user, "-p", pass}
 
-	return exec.Command(s.config.FloatBinPath, args...).Run()
+	output, err := exec.Command(s.config.FloatBinPath, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("float login failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
 }
 
-func injectConfig(configOverride string, nfCommand string) string {
-	nfConfig := fmt.Sprintf(`
-export GITHUB_TOKEN=%s
-nextflow_command='%s'`, os.Getenv("GITHUB_TOKEN"), nfCommand)
-
-	config := fileJobSubmitAWS
-
-	// injecting config overrides
-	config = strings.Replace(config, configOverrideNeedle, configOverride, 1)
-
-	// injecting nextflow command
-	config = strings.Replace(config, configNextflowCmdNeedle, nfConfig, 1)
-
-	return config
+// float runs a float subcommand and returns its combined output
+func (s *Service) float(ctx context.Context, args ...string) (string, error) {
+	output, err := exec.CommandContext(ctx, s.config.FloatBinPath, args...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("float %s failed: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
 }
 
-func (s *Service) storeJobFiles(tempDir string, configOverride string, nfCommand string) error {
+func (s *Service) storeJobFiles(tempDir string, job jobScript) error {
+	jobSubmit, err := job.Render(fileJobSubmitAWS)
+	if err != nil {
+		return fmt.Errorf("rendering job script: %w", err)
+	}
+
 	files := map[string]string{
-		"job_submit_AWS.sh":    injectConfig(configOverride, nfCommand),
+		"job_submit_AWS.sh":    jobSubmit,
 		"transient_JFS_AWS.sh": fileTransientJFSAWS,
 		"hostTerminate_AWS.sh": fileHostTerminateAWS,
 	}
@@ -116,18 +119,33 @@ func (s *Service) Execute(ctx context.Context, run runner.RunConfig, runName str
 	tempDir, err := os.MkdirTemp("", "float-runner-")
 	if err != nil {
 		s.Logger.Error("Failed to create temporary directory", "error", err)
-		return "", err
+		return "", runner.NotSubmitted(err)
+	}
+
+	// generate nextflow command, the job config comes before any config
+	// given with the parameters
+	run.Args = append([]string{"-c", jobConfigFile}, run.Args...)
+
+	params, err := run.ParamsFile()
+	if err != nil {
+		return "", runner.NotSubmitted(err)
+	}
+	if params != nil {
+		run.Args = append(run.Args, "-params-file", paramsFile(runName))
 	}
 
-	// generate nextflow command
-	nfArgs := append([]string{s.config.NextflowBinPath, "run", run.PipelineUrl, "-c", "mmc.config"}, run.Args...)
-	nfCommand := strings.Join(nfArgs, " ")
-	fmt.Println(nfCommand)
+	nfArgs := append([]string{s.config.NextflowBinPath}, run.CmdArgs()...)
 
 	s.Logger.Info("float execute", "action", "storing job files")
-	err = s.storeJobFiles(tempDir, run.ConfigOverride, nfCommand)
+	err = s.storeJobFiles(tempDir, jobScript{
+		ConfigOverride: run.ConfigOverride,
+		Command:        nfArgs,
+		Params:         params,
+		ParamsFile:     paramsFile(runName),
+		GithubToken:    os.Getenv("GITHUB_TOKEN"),
+	})
 	if err != nil {
-		return "", err
+		return "", runner.NotSubmitted(err)
 	}
 
 	sg := os.Getenv("FLOAT_AWS_SG")
@@ -156,30 +174,99 @@ func (s *Service) Execute(ctx context.Context, run runner.RunConfig, runName str
 	mounts := extractMountPaths(run.ConfigOverride)
 	args = append(args, mounts...)
 
-	go func() {
-		s.Logger.Info("float execute", "action", "authenticating")
-		err = s.auth()
-		if err != nil {
-			s.Logger.Error("failed to authenticate", "error", err)
+	s.Logger.Info("float execute", "action", "authenticating")
+	err = s.auth()
+	if err != nil {
+		s.Logger.Error("failed to authenticate", "error", err)
+		return "", runner.NotSubmitted(err)
+	}
+
+	s.Logger.Info("float execute", "action", "Running command")
+	defer os.RemoveAll(tempDir)
+	cmd := exec.CommandContext(ctx, s.config.FloatBinPath, args...)
+	cmd.Dir = tempDir
+	output, err := cmd.CombinedOutput()
+	s.Logger.Debug("float exec output", "output", string(output))
+	if err != nil {
+		s.Logger.Debug("float exec error", "error", err, "output", output)
+		return "", fmt.Errorf("float submit failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	jobID := extractField(string(output), "id")
+	if jobID == "" {
+		return "", fmt.Errorf("float submit did not report a job id: %s", strings.TrimSpace(string(output)))
+	}
+
+	s.Logger.Info("float job submitted", "job_id", jobID)
+	s.Poll(runName, jobID, false)
+
+	return jobID, nil
+}
+
+func (s *Service) Stop(c runner.StopConfig) error {
+	if c.ProcessId == "" {
+		return fmt.Errorf("invalid float job ID: %q", c.ProcessId)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+
+	var err error
+	for attempt := 1; attempt <= stopAttempts; attempt++ {
+		err = s.cancel(ctx, c.ProcessId)
+		if err == nil || errors.Is(err, runner.ErrAlreadyFinished) {
+			return err
 		}
 
-		s.Logger.Info("float execute", "action", "Running command")
-		defer os.RemoveAll(tempDir)
-		cmd := exec.Command(s.config.FloatBinPath, args...)
-		cmd.Dir = tempDir
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			s.Logger.Debug("float exec error", "error", err, "output", output)
+		s.Logger.Info("Failed to cancel float job", "job_id", c.ProcessId, "attempt", attempt, "error", err)
+		select {
+		case <-time.After(time.Duration(attempt) * stopRetryDelay):
+		case <-ctx.Done():
+			return fmt.Errorf("cancelling float job %s: %w", c.ProcessId, ctx.Err())
 		}
-		s.Logger.Debug("float exec output", "output", string(output))
-	}()
+	}
 
-	return "", nil
+	return fmt.Errorf("cancelling float job %s: %w", c.ProcessId, err)
 }
 
-func (s *Service) Stop(c runner.StopConfig) error {
-	// not implemented
-	return nil
+func (s *Service) cancel(ctx context.Context, jobID string) error {
+	status, err := s.status(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	if terminalStatuses[status] {
+		return fmt.Errorf("%w: float job %s is %s", runner.ErrAlreadyFinished, jobID, status)
+	}
+
+	_, err = s.float(ctx, "cancel", "-j", jobID)
+	return err
+}
+
+// status returns the status of a float job
+func (s *Service) status(ctx context.Context, jobID string) (string, error) {
+	err := s.auth()
+	if err != nil {
+		return "", err
+	}
+
+	output, err := s.float(ctx, "show", "-j", jobID)
+	if err != nil {
+		return "", err
+	}
+	return extractField(output, "status"), nil
+}
+
+// Alive reports whether a float job has not reached a terminal status
+func (s *Service) Alive(ctx context.Context, processKey string) (bool, error) {
+	if processKey == "" {
+		return false, fmt.Errorf("invalid float job ID: %q", processKey)
+	}
+
+	status, err := s.status(ctx, processKey)
+	if err != nil {
+		return false, err
+	}
+	return !terminalStatuses[status], nil
 }
 
 func (s *Service) BinPath() string {
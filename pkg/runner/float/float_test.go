@@ -0,0 +1,225 @@
+package float
+
+import (
+	"bytes"
+	"encoding/json"
+	"nf-shard-orchestrator/pkg/runner"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTemplate mirrors the parts of job_submit_AWS.sh the needles sit in
+// and dumps what the generated shell produced
+const testTemplate = `workDir=/mnt/jfs/
+cat > mmc.config << EOF
+// start ${workDir}
+EOF
+SHARD_CONFIG_OVERRIDE
+cat >> mmc.config << EOF
+// end ${workDir}
+EOF
+SHARD_PARAMS_FILE
+SHARD_NEXTFLOW_COMMAND
+printf '%s' "$GITHUB_TOKEN" > token
+printf '%s\0' "${nextflow_command[@]}" > command
+`
+
+// hostile values, each also touches a file if the shell ever runs it
+var hostile = []string{
+	`it's`,
+	`'; touch pwned; echo '`,
+	`$(touch pwned)`,
+	"`touch pwned`",
+	`${HOME} $workDir "quoted" \n \`,
+	"line one\ntouch pwned\nline three",
+	"EOF\ntouch pwned",
+	"EOT\ntouch pwned",
+	"SHARD_EOF_0123456789abcdef\ntouch pwned",
+	"SHARD_PARAMS_FILE\nSHARD_NEXTFLOW_COMMAND",
+	"  leading and trailing spaces  ",
+	"*",
+	"",
+}
+
+func runScript(t *testing.T, script string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	cmd := exec.Command("bash", "-c", script)
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("script failed: %v: %s\n%s", err, output, script)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+		t.Fatalf("script ran an injected command:\n%s", script)
+	}
+	return dir
+}
+
+func readFile(t *testing.T, dir string, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestJobScript(t *testing.T) {
+	for _, value := range hostile {
+		t.Run(value, func(t *testing.T) {
+			job := jobScript{
+				ConfigOverride: value,
+				Command:        []string{"nextflow", "run", value, "--input", value},
+				Params:         []byte(value),
+				ParamsFile:     paramsFile("hostile-run"),
+				GithubToken:    value,
+			}
+			if value == "" {
+				job.GithubToken = "token"
+			}
+
+			script, err := job.Render(testTemplate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := runScript(t, script)
+
+			override := value
+			if !strings.HasSuffix(override, "\n") {
+				override += "\n"
+			}
+			wantConfig := "// start /mnt/jfs/\n" + override + "// end /mnt/jfs/\n"
+			if got := readFile(t, dir, jobConfigFile); got != wantConfig {
+				t.Errorf("config = %q, want %q", got, wantConfig)
+			}
+
+			if got := readFile(t, dir, job.ParamsFile); got != override {
+				t.Errorf("params = %q, want %q", got, override)
+			}
+
+			if got := readFile(t, dir, "token"); got != job.GithubToken {
+				t.Errorf("token = %q, want %q", got, job.GithubToken)
+			}
+
+			command := strings.Split(strings.TrimSuffix(readFile(t, dir, "command"), "\x00"), "\x00")
+			if !reflect.DeepEqual(command, job.Command) {
+				t.Errorf("command = %q, want %q", command, job.Command)
+			}
+		})
+	}
+}
+
+func TestJobScriptOptional(t *testing.T) {
+	script, err := jobScript{Command: []string{"nextflow", "run", "hello"}}.Render(testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := runScript(t, script)
+
+	if _, err := os.Stat(filepath.Join(dir, runner.ParamsFileName)); !os.IsNotExist(err) {
+		t.Errorf("expected no params file, got %v", err)
+	}
+	if got := readFile(t, dir, "token"); got != "" {
+		t.Errorf("expected no github token, got %q", got)
+	}
+}
+
+func TestJobScriptErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      jobScript
+		template string
+	}{
+		{"empty command", jobScript{}, testTemplate},
+		{"NUL in argument", jobScript{Command: []string{"nextflow", "a\x00b"}}, testTemplate},
+		{"NUL in config", jobScript{ConfigOverride: "a\x00b", Command: []string{"nextflow"}}, testTemplate},
+		{"missing needle", jobScript{Command: []string{"nextflow"}}, strings.Replace(testTemplate, paramsFileNeedle, "", 1)},
+		{"repeated needle", jobScript{Command: []string{"nextflow"}}, testTemplate + configNextflowCmdNeedle + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.job.Render(tt.template)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestJobSubmitTemplate(t *testing.T) {
+	script, err := jobScript{
+		ConfigOverride: "process.cpus = 2",
+		Command:        []string{"nextflow", "run", "it's"},
+		Params:         []byte("{}"),
+	}.Render(fileJobSubmitAWS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`nextflow_command=('nextflow' 'run' 'it'\''s')`,
+		`"${nextflow_command[@]}"`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("expected the job script to contain %s", want)
+		}
+	}
+
+	cmd := exec.Command("bash", "-n")
+	cmd.Stdin = bytes.NewBufferString(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("job script has a syntax error: %v: %s", err, output)
+	}
+}
+
+func TestParamsFile(t *testing.T) {
+	params := map[string]any{
+		"input":    "s3://bucket/samples $HOME `id`.csv",
+		"title":    "it's a \"test\"\nEOF",
+		"skip_qc":  true,
+		"max_cpus": float64(16),
+		"genomes":  []any{"GRCh38", "GRCm39"},
+		"options":  map[string]any{"depth": float64(2)},
+	}
+	data, err := runner.RunConfig{Params: params}.ParamsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// jobs of concurrent runs share the working dir
+	var scripts []string
+	for _, runName := range []string{"run-a", "run-b"} {
+		job := jobScript{Command: []string{"nextflow"}, Params: data, ParamsFile: paramsFile(runName)}
+		if runName == "run-b" {
+			job.Params = []byte(`{"input": "b.csv"}`)
+		}
+		script, err := job.Render(testTemplate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts = append(scripts, script)
+	}
+	dir := runScript(t, strings.Join(scripts, "\n"))
+
+	var got map[string]any
+	err = json.Unmarshal([]byte(readFile(t, dir, paramsFile("run-a"))), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, params) {
+		t.Errorf("params file = %v, want %v", got, params)
+	}
+	if got := readFile(t, dir, paramsFile("run-b")); got != "{\"input\": \"b.csv\"}\n" {
+		t.Errorf("params file of run-b = %q", got)
+	}
+}
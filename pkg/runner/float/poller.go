@@ -0,0 +1,227 @@
+package float
+
+import (
+	"context"
+	"fmt"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/runs"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second
+
+	// consecutive failed polls after which the job is given up on
+	maxPollFailures = 30
+)
+
+// job log files kept by float and the stream their lines are published as,
+// in the order they are published
+var logFiles = []struct {
+	file   string
+	stream model.LogStream
+}{
+	{"stdout.autosave", model.LogStreamStdout},
+	{"stderr.autosave", model.LogStreamStderr},
+}
+
+type poller struct {
+	s       *Service
+	jobID   string
+	runName string
+	status  string
+	// number of lines already published per log file
+	offsets  map[string]int
+	failures int
+}
+
+// Poll follows a submitted float job, publishing its status changes and log
+// lines to the run's log stream until the job reaches a terminal state.
+// Existing log lines are skipped when resuming a job after a worker restart.
+func (s *Service) Poll(runName string, jobID string, resumed bool) {
+	p := &poller{
+		s:       s,
+		jobID:   jobID,
+		runName: runName,
+		offsets: make(map[string]int),
+	}
+
+	go p.run(resumed)
+}
+
+func (p *poller) run(resumed bool) {
+	ctx := context.Background()
+	startedAt := time.Now()
+
+	interval := p.s.config.PollInterval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+
+	if resumed {
+		p.skipLogs(ctx)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		done, err := p.poll(ctx)
+		if err != nil {
+			p.failures++
+			p.s.Logger.Info("float poll failed", "job_id", p.jobID, "failures", p.failures, "error", err)
+			if p.failures >= maxPollFailures {
+				p.abandon(startedAt, resumed, fmt.Sprintf("Stopped following float job %s after %d failed polls: %v", p.jobID, p.failures, err))
+				return
+			}
+
+			// session may have expired
+			if err := p.s.auth(); err != nil {
+				p.s.Logger.Info("float poll login failed", "error", err)
+			}
+		} else {
+			p.failures = 0
+		}
+
+		if done {
+			p.finish(startedAt, resumed)
+			return
+		}
+
+		<-ticker.C
+	}
+}
+
+// poll publishes new status and log lines, reporting whether the job ended
+func (p *poller) poll(ctx context.Context) (bool, error) {
+	output, err := p.s.float(ctx, "show", "-j", p.jobID)
+	if err != nil {
+		return false, err
+	}
+
+	status := extractField(output, "status")
+	if status != "" && status != p.status {
+		p.status = status
+		p.publish(model.Log{Message: fmt.Sprintf("Float job %s status: %s", p.jobID, status)})
+	}
+
+	err = p.publishLogs(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return terminalStatuses[p.status], nil
+}
+
+func (p *poller) publishLogs(ctx context.Context) error {
+	for _, log := range logFiles {
+		file, stream := log.file, log.stream
+		lines, err := p.logLines(ctx, file)
+		if err != nil {
+			return err
+		}
+
+		offset := p.offsets[file]
+		if offset > len(lines) {
+			// log was truncated, e.g. after a job migration
+			offset = 0
+		}
+		for _, line := range lines[offset:] {
+			p.publish(model.Log{Message: line, Stream: stream})
+		}
+		p.offsets[file] = len(lines)
+	}
+
+	return nil
+}
+
+func (p *poller) skipLogs(ctx context.Context) {
+	for _, log := range logFiles {
+		file := log.file
+		lines, err := p.logLines(ctx, file)
+		if err != nil {
+			p.s.Logger.Info("failed to read float log", "job_id", p.jobID, "file", file, "error", err)
+			continue
+		}
+		p.offsets[file] = len(lines)
+	}
+}
+
+func (p *poller) logLines(ctx context.Context, file string) ([]string, error) {
+	output, err := p.s.float(ctx, "log", "cat", "-j", p.jobID, file)
+	if err != nil {
+		return nil, err
+	}
+
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return []string{}, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+func (p *poller) publish(log model.Log) {
+	err := logstream.PublishLog(p.s.Js, p.runName, log)
+	if err != nil {
+		p.s.Logger.Error("Failed to publish log", "error", err)
+	}
+}
+
+func (p *poller) finish(startedAt time.Time, resumed bool) {
+	finishedAt := time.Now().UTC().Format(time.RFC3339)
+	status := model.RunStatus{
+		RunName:    p.runName,
+		ProcessKey: &p.jobID,
+		State:      runState(p.status),
+		StderrTail: []string{},
+		FinishedAt: &finishedAt,
+	}
+	if !resumed {
+		seconds := time.Since(startedAt).Seconds()
+		status.DurationSeconds = &seconds
+	}
+
+	err := runs.PublishFinished(p.s.Nc, status)
+	if err != nil {
+		p.s.Logger.Error("Failed to publish run status", "error", err)
+	}
+}
+
+// abandon reports the run failed when its job can no longer be followed,
+// otherwise it would stay running and hold its queue slot
+func (p *poller) abandon(startedAt time.Time, resumed bool, cause string) {
+	p.publish(model.Log{Message: cause, Level: model.LogLevelError})
+
+	finishedAt := time.Now().UTC().Format(time.RFC3339)
+	status := model.RunStatus{
+		RunName:    p.runName,
+		ProcessKey: &p.jobID,
+		State:      model.RunStateFailed,
+		StderrTail: []string{},
+		Error:      &cause,
+		FinishedAt: &finishedAt,
+	}
+	if !resumed {
+		seconds := time.Since(startedAt).Seconds()
+		status.DurationSeconds = &seconds
+	}
+
+	err := runs.PublishFinished(p.s.Nc, status)
+	if err != nil {
+		p.s.Logger.Error("Failed to publish run status", "error", err)
+	}
+}
+
+// runState maps a terminal float status to a run state
+func runState(status string) model.RunState {
+	switch status {
+	case "Completed":
+		return model.RunStateSucceeded
+	case "Cancelled":
+		return model.RunStateCancelled
+	default:
+		return model.RunStateFailed
+	}
+}
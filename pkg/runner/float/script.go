@@ -0,0 +1,156 @@
+package float
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"nf-shard-orchestrator/pkg/runner"
+	"path"
+	"strings"
+)
+
+// lines of the job script replaced with generated shell, each has to be
+// on a line of its own
+const (
+	configOverrideNeedle    = "SHARD_CONFIG_OVERRIDE"
+	paramsFileNeedle        = "SHARD_PARAMS_FILE"
+	configNextflowCmdNeedle = "SHARD_NEXTFLOW_COMMAND"
+)
+
+// jobConfigFile is the nextflow config written by the job script
+const jobConfigFile = "mmc.config"
+
+// paramsFile is the params file of a run. Jobs share the working dir, each
+// run writes its params to a dir of its own.
+func paramsFile(runName string) string {
+	return path.Join(runName, runner.ParamsFileName)
+}
+
+// jobScript holds the values templated into the float job script. Values
+// never reach the shell unquoted: words are single quoted and file
+// contents are written with quoted heredocs.
+type jobScript struct {
+	ConfigOverride string
+	// Command is the nextflow binary followed by its arguments
+	Command []string
+	// Params is written to ParamsFile, relative to the working dir
+	Params      []byte
+	ParamsFile  string
+	GithubToken string
+}
+
+// Render replaces the needles of the template with the shell writing the
+// config override and params file and setting up the nextflow command
+func (j jobScript) Render(template string) (string, error) {
+	config, err := heredoc(">>", jobConfigFile, j.ConfigOverride)
+	if err != nil {
+		return "", fmt.Errorf("config override: %w", err)
+	}
+
+	params := ""
+	if j.Params != nil {
+		params, err = heredoc(">", j.ParamsFile, string(j.Params))
+		if err != nil {
+			return "", fmt.Errorf("params: %w", err)
+		}
+		params = fmt.Sprintf("mkdir -p %s\n%s", runner.ShellQuote(path.Dir(j.ParamsFile)), params)
+	}
+
+	command, err := j.command()
+	if err != nil {
+		return "", err
+	}
+
+	return renderScript(template, map[string]string{
+		configOverrideNeedle:    config,
+		paramsFileNeedle:        params,
+		configNextflowCmdNeedle: command,
+	})
+}
+
+// command exports the github token and stores the nextflow command in an
+// array, the script runs it with "${nextflow_command[@]}"
+func (j jobScript) command() (string, error) {
+	if len(j.Command) == 0 {
+		return "", fmt.Errorf("empty nextflow command")
+	}
+
+	words := make([]string, len(j.Command))
+	for i, word := range j.Command {
+		if strings.ContainsRune(word, 0) {
+			return "", fmt.Errorf("nextflow argument %d contains a NUL byte", i)
+		}
+		words[i] = runner.ShellQuote(word)
+	}
+
+	token := ""
+	if j.GithubToken != "" {
+		if strings.ContainsRune(j.GithubToken, 0) {
+			return "", fmt.Errorf("github token contains a NUL byte")
+		}
+		token = fmt.Sprintf("export GITHUB_TOKEN=%s\n", runner.ShellQuote(j.GithubToken))
+	}
+
+	return fmt.Sprintf("%snextflow_command=(%s)", token, strings.Join(words, " ")), nil
+}
+
+// renderScript replaces every needle line of the template with its
+// fragment, each needle has to appear exactly once. Fragments are not
+// searched for needles so values can't inject into other parts.
+func renderScript(template string, fragments map[string]string) (string, error) {
+	found := make(map[string]int, len(fragments))
+
+	lines := strings.Split(template, "\n")
+	for i, line := range lines {
+		fragment, ok := fragments[strings.TrimSpace(line)]
+		if !ok {
+			continue
+		}
+		found[strings.TrimSpace(line)]++
+		lines[i] = fragment
+	}
+
+	for needle := range fragments {
+		if found[needle] != 1 {
+			return "", fmt.Errorf("job script has %d %s lines, expected one", found[needle], needle)
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// heredoc writes content to a file, redirect is > or >>. The delimiter is
+// quoted so the shell doesn't expand the content and random so the
+// content can't end the heredoc early.
+func heredoc(redirect string, file string, content string) (string, error) {
+	if strings.ContainsRune(content, 0) {
+		return "", fmt.Errorf("contains a NUL byte")
+	}
+
+	delimiter, err := newDelimiter(content)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	return fmt.Sprintf("cat %s %s << '%s'\n%s%s", redirect, runner.ShellQuote(file), delimiter, content, delimiter), nil
+}
+
+// newDelimiter returns a heredoc delimiter that doesn't occur in content
+func newDelimiter(content string) (string, error) {
+	for {
+		b := make([]byte, 8)
+		_, err := rand.Read(b)
+		if err != nil {
+			return "", fmt.Errorf("generating heredoc delimiter: %w", err)
+		}
+
+		delimiter := "SHARD_EOF_" + hex.EncodeToString(b)
+		if !strings.Contains(content, delimiter) {
+			return delimiter, nil
+		}
+	}
+}
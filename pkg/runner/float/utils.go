@@ -2,8 +2,18 @@ package float
 
 import (
 	"regexp"
+	"strings"
 )
 
+// float reports job statuses which end the job
+var terminalStatuses = map[string]bool{
+	"Completed":      true,
+	"Cancelled":      true,
+	"FailToComplete": true,
+	"FailToExecute":  true,
+	"Timedout":       true,
+}
+
 func extractMountPaths(input string) []string {
 	re := regexp.MustCompile(`(--dataVolume)\s+(\[(?:[^\]]*)\]s3://[^:\s]+:[^\s']+)`)
 	matches := re.FindAllStringSubmatch(input, -1)
@@ -15,3 +25,18 @@ func extractMountPaths(input string) []string {
 	}
 	return result
 }
+
+// extractField returns the value of a top level `key: value` line in the
+// output of float commands such as `float submit` and `float show`
+func extractField(output string, key string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -83,3 +83,33 @@ func equalStringSlices(a, b []string) bool {
 	}
 	return true
 }
+
+func TestExtractField(t *testing.T) {
+	submitOutput := `id: 2g4f1wq8s9sbqqlk8x6cx
+name: shard-run
+user: admin
+imageID: docker.io/memverge/juiceflow:latest
+status: Initializing
+submitTime: "2024-07-30T10:11:12Z"
+`
+	tests := []struct {
+		name     string
+		output   string
+		key      string
+		expected string
+	}{
+		{name: "Job ID", output: submitOutput, key: "id", expected: "2g4f1wq8s9sbqqlk8x6cx"},
+		{name: "Status", output: submitOutput, key: "status", expected: "Initializing"},
+		{name: "Missing key", output: submitOutput, key: "exitCode", expected: ""},
+		{name: "Nested key ignored", output: "job:\n  id: nested\nid: top", key: "id", expected: "top"},
+		{name: "Empty output", output: "", key: "id", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := extractField(tt.output, tt.key); result != tt.expected {
+				t.Errorf("extractField(%q) = %q, want %q", tt.key, result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package hpc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"nf-shard-orchestrator/pkg/runner"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	_ runner.Runner      = &Service{}
+	_ runner.LaunchDirer = &Service{}
+)
+
+// Scheduler is the batch system the nextflow head job is submitted to
+type Scheduler string
+
+const (
+	Slurm Scheduler = "slurm"
+	PBS   Scheduler = "pbs"
+)
+
+// files written to the launch directory of a run
+const (
+	scriptFile    = "job.sh"
+	configFile    = "shard.config"
+	stdoutFile    = "stdout.log"
+	stderrFile    = "stderr.log"
+	exitCodeFile  = "exitcode"
+	schedulerFile = "scheduler.log"
+)
+
+// PBS job names are limited to 15 characters on some installations
+const pbsJobNameLength = 15
+
+var jobIDRegex = regexp.MustCompile(`^[-._a-zA-Z0-9\[\]]+$`)
+
+type Config struct {
+	Logger          *slog.Logger
+	Wg              *sync.WaitGroup
+	Js              jetstream.JetStream
+	Nc              *nats.Conn
+	Scheduler       Scheduler
+	NextflowBinPath string
+	// SubmitBinPath, CancelBinPath and StatusBinPath default to sbatch,
+	// scancel and squeue for slurm and qsub, qdel and qstat for PBS
+	SubmitBinPath string
+	CancelBinPath string
+	StatusBinPath string
+	// BaseDir is shared with the cluster nodes and holds the launch
+	// directory of every run
+	BaseDir string
+	// Queue is the partition or queue of the head job and its tasks,
+	// empty leaves the cluster default
+	Queue        string
+	PollInterval time.Duration
+}
+
+func (c Config) Validate() error {
+	if c.Scheduler != Slurm && c.Scheduler != PBS {
+		return fmt.Errorf("unknown scheduler: %q", c.Scheduler)
+	}
+	if !filepath.IsAbs(c.BaseDir) {
+		return fmt.Errorf("base directory must be an absolute path: %q", c.BaseDir)
+	}
+	if strings.ContainsAny(c.Queue, " \t\n'\"") {
+		return fmt.Errorf("invalid queue: %q", c.Queue)
+	}
+	return nil
+}
+
+// Service submits the nextflow head process as a batch job, tasks are
+// submitted by nextflow to the same scheduler
+type Service struct {
+	config Config
+	Wg     *sync.WaitGroup
+	Logger *slog.Logger
+	Js     jetstream.JetStream
+	Nc     *nats.Conn
+}
+
+func NewRunner(c Config) (*Service, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	submit, cancel, status := "sbatch", "scancel", "squeue"
+	if c.Scheduler == PBS {
+		submit, cancel, status = "qsub", "qdel", "qstat"
+	}
+	if c.SubmitBinPath == "" {
+		c.SubmitBinPath = submit
+	}
+	if c.CancelBinPath == "" {
+		c.CancelBinPath = cancel
+	}
+	if c.StatusBinPath == "" {
+		c.StatusBinPath = status
+	}
+
+	return &Service{
+		config: c,
+		Wg:     c.Wg,
+		Logger: c.Logger,
+		Js:     c.Js,
+		Nc:     c.Nc,
+	}, nil
+}
+
+// Executor is the name runs of this scheduler are submitted with
+func (s *Service) Executor() string {
+	return string(s.config.Scheduler)
+}
+
+// LaunchDir is the directory shared with the cluster nodes a run is launched in
+func (s *Service) LaunchDir(runName string) string {
+	return filepath.Join(s.config.BaseDir, runName)
+}
+
+// command runs a scheduler binary and returns its combined output
+func (s *Service) command(ctx context.Context, binPath string, args ...string) (string, error) {
+	output, err := exec.CommandContext(ctx, binPath, args...).CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("%s failed: %w: %s", filepath.Base(binPath), err, strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// schedulerConfig is appended to the config override so tasks are
+// submitted to the scheduler running the head job
+func (s *Service) schedulerConfig() string {
+	queue := ""
+	if s.config.Queue != "" {
+		queue = fmt.Sprintf("\n    queue = '%s'", s.config.Queue)
+	}
+
+	return fmt.Sprintf(`
+process {
+    executor = '%s'%s
+}
+`, s.config.Scheduler, queue)
+}
+
+func (s *Service) submitArgs(runName string, runDir string) []string {
+	script := filepath.Join(runDir, scriptFile)
+	output := filepath.Join(runDir, schedulerFile)
+
+	if s.config.Scheduler == PBS {
+		name := runName
+		if len(name) > pbsJobNameLength {
+			name = name[:pbsJobNameLength]
+		}
+		args := []string{"-N", name, "-o", output, "-j", "oe", "-V"}
+		if s.config.Queue != "" {
+			args = append(args, "-q", s.config.Queue)
+		}
+		return append(args, script)
+	}
+
+	args := []string{"--parsable", "--job-name=" + runName, "--chdir=" + runDir, "--output=" + output}
+	if s.config.Queue != "" {
+		args = append(args, "--partition="+s.config.Queue)
+	}
+	return append(args, script)
+}
+
+// parseJobID reads the job ID from the submit output, sbatch --parsable
+// prints `id[;cluster]` and qsub the full job ID
+func (s *Service) parseJobID(output string) (string, error) {
+	jobID := strings.TrimSpace(output)
+	if s.config.Scheduler == Slurm {
+		jobID, _, _ = strings.Cut(jobID, ";")
+	}
+
+	if !jobIDRegex.MatchString(jobID) {
+		return "", fmt.Errorf("%s did not report a job id: %q", filepath.Base(s.config.SubmitBinPath), strings.TrimSpace(output))
+	}
+	return jobID, nil
+}
+
+func (s *Service) Execute(ctx context.Context, run runner.RunConfig, runName string) (string, error) {
+	s.Wg.Add(1)
+	defer s.Wg.Done()
+
+	runDir := s.LaunchDir(runName)
+	err := os.MkdirAll(runDir, 0755)
+	if err != nil {
+		s.Logger.Error("Failed to create run directory", "error", err)
+		return "", runner.NotSubmitted(err)
+	}
+
+	// files of an earlier job in the same directory would be mistaken
+	// for the output of this one
+	for _, file := range []string{exitCodeFile, stdoutFile, stderrFile, schedulerFile} {
+		err := os.Remove(filepath.Join(runDir, file))
+		if err != nil && !os.IsNotExist(err) {
+			return "", runner.NotSubmitted(err)
+		}
+	}
+
+	err = os.WriteFile(filepath.Join(runDir, configFile), []byte(run.ConfigOverride+s.schedulerConfig()), 0644)
+	if err != nil {
+		s.Logger.Error("Failed to write config file", "error", err)
+		return "", runner.NotSubmitted(err)
+	}
+
+	run, err = run.WriteParamsFile(runDir)
+	if err != nil {
+		s.Logger.Error("Failed to write params file", "error", err)
+		return "", runner.NotSubmitted(err)
+	}
+
+	nextflowRunName := run.NextflowRunName()
+	if nextflowRunName == "" {
+		nextflowRunName = runName
+	}
+
+	nfArgs := append([]string{s.config.NextflowBinPath, "-log", runner.LogFile(runDir, nextflowRunName)}, run.CmdArgs()...)
+	nfArgs = append(nfArgs, "-c", configFile)
+	err = os.WriteFile(filepath.Join(runDir, scriptFile), []byte(jobScript(runDir, nfArgs)), 0755)
+	if err != nil {
+		s.Logger.Error("Failed to write job script", "error", err)
+		return "", runner.NotSubmitted(err)
+	}
+
+	output, err := s.command(ctx, s.config.SubmitBinPath, s.submitArgs(runName, runDir)...)
+	if err != nil {
+		return "", err
+	}
+
+	jobID, err := s.parseJobID(output)
+	if err != nil {
+		return "", err
+	}
+
+	s.Logger.Info("hpc job submitted", "scheduler", s.config.Scheduler, "job_id", jobID)
+	s.Poll(runName, jobID, false)
+
+	return jobID, nil
+}
+
+func (s *Service) Stop(c runner.StopConfig) error {
+	if !jobIDRegex.MatchString(c.ProcessId) {
+		return fmt.Errorf("invalid %s job ID: %q", s.config.Scheduler, c.ProcessId)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	state, active, err := s.jobState(ctx, c.ProcessId)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return fmt.Errorf("%w: %s job %s is %s", runner.ErrAlreadyFinished, s.config.Scheduler, c.ProcessId, state)
+	}
+
+	_, err = s.command(ctx, s.config.CancelBinPath, c.ProcessId)
+	return err
+}
+
+// Alive reports whether the job of a run is still known to the scheduler
+func (s *Service) Alive(ctx context.Context, processKey string) (bool, error) {
+	if !jobIDRegex.MatchString(processKey) {
+		return false, fmt.Errorf("invalid %s job ID: %q", s.config.Scheduler, processKey)
+	}
+
+	_, active, err := s.jobState(ctx, processKey)
+	return active, err
+}
+
+func (s *Service) BinPath() string {
+	return s.config.NextflowBinPath
+}
@@ -0,0 +1,323 @@
+package hpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/natstest"
+	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runs"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func newTestNats(t *testing.T) (*nats.Conn, jetstream.JetStream) {
+	t.Helper()
+
+	nc, js := natstest.Start(t)
+
+	_, err := logstream.CreateStream(context.Background(), js, time.Hour, logstream.DefaultMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nc, js
+}
+
+// writeScript writes an executable stand-in for a scheduler binary
+func writeScript(t *testing.T, dir string, name string, body string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte("#!/bin/bash\n"+body), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestService(t *testing.T, scheduler Scheduler, bins map[string]string) (*Service, *nats.Conn, jetstream.JetStream) {
+	t.Helper()
+
+	nc, js := newTestNats(t)
+	binDir := t.TempDir()
+
+	s, err := NewRunner(Config{
+		Logger:          slog.New(slog.NewTextHandler(&strings.Builder{}, nil)),
+		Wg:              &sync.WaitGroup{},
+		Js:              js,
+		Nc:              nc,
+		Scheduler:       scheduler,
+		NextflowBinPath: writeScript(t, binDir, "nextflow", bins["nextflow"]),
+		SubmitBinPath:   writeScript(t, binDir, "submit", bins["submit"]),
+		CancelBinPath:   writeScript(t, binDir, "cancel", bins["cancel"]),
+		StatusBinPath:   writeScript(t, binDir, "status", bins["status"]),
+		BaseDir:         t.TempDir(),
+		Queue:           "short",
+		PollInterval:    20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, nc, js
+}
+
+func TestExecute(t *testing.T) {
+	s, nc, js := newTestService(t, Slurm, map[string]string{
+		// runs the job script in place of the cluster
+		"submit":   `echo "$@" > "$(dirname "${@: -1}")/submit-args"; bash "${@: -1}"; echo "42;cluster"`,
+		"status":   `echo "slurm_load_jobs error: Invalid job id specified" >&2; exit 1`,
+		"nextflow": `echo "N E X T F L O W"; echo "args: $*"; echo "it's broken" >&2; exit 3`,
+	})
+
+	sub, err := nc.SubscribeSync(runs.FinishedSubject("run-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := runner.RunConfig{
+		PipelineUrl:    "https://github.com/nf-core/rnaseq",
+		ConfigOverride: "params.x = 1",
+		Args:           []string{"-profile", "test", "--title", "it's a test"},
+	}
+	jobID, err := s.Execute(context.Background(), run, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobID != "42" {
+		t.Fatalf("expected job id 42, got %q", jobID)
+	}
+
+	submitArgs, err := os.ReadFile(filepath.Join(s.LaunchDir("run-1"), "submit-args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(submitArgs), "--job-name=run-1") || !strings.Contains(string(submitArgs), "--partition=short") {
+		t.Errorf("unexpected submit args: %s", submitArgs)
+	}
+
+	config, err := os.ReadFile(filepath.Join(s.LaunchDir("run-1"), configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(config), "executor = 'slurm'") || !strings.Contains(string(config), "queue = 'short'") {
+		t.Errorf("unexpected config: %s", config)
+	}
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status model.RunStatus
+	err = json.Unmarshal(msg.Data, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != model.RunStateFailed || status.ExitCode == nil || *status.ExitCode != 3 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	if !reflect.DeepEqual(status.StderrTail, []string{"it's broken"}) {
+		t.Errorf("unexpected stderr tail: %v", status.StderrTail)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	logs, err := logstream.Subscribe(ctx, js, "run-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := map[string]bool{}
+	for len(messages) < 3 {
+		select {
+		case log := <-logs:
+			messages[log.Message] = true
+		case <-ctx.Done():
+			t.Fatalf("missing logs, got %v", messages)
+		}
+	}
+	for _, want := range []string{
+		"N E X T F L O W",
+		"args: -log " + runner.LogFile(s.LaunchDir("run-1"), "run-1") + " run https://github.com/nf-core/rnaseq -profile test --title it's a test -c shard.config",
+		"it's broken",
+	} {
+		if !messages[want] {
+			t.Errorf("expected log %q, got %v", want, messages)
+		}
+	}
+}
+
+func TestExecuteSubmitFailure(t *testing.T) {
+	s, _, _ := newTestService(t, Slurm, map[string]string{
+		"submit": `echo "sbatch: error: Socket timed out, connection reset by peer" >&2; exit 1`,
+	})
+
+	// the job may have been queued before the connection was lost
+	_, err := s.Execute(context.Background(), runner.RunConfig{PipelineUrl: "nf-core/demo"}, "run-1")
+	if err == nil {
+		t.Fatal("expected submit to fail")
+	}
+	if runner.BeforeSubmit(nil)(err) {
+		t.Errorf("expected failed submission not to be retried, got %v", err)
+	}
+
+	s.config.BaseDir = filepath.Join(s.config.NextflowBinPath, "not-a-dir")
+	_, err = s.Execute(context.Background(), runner.RunConfig{PipelineUrl: "nf-core/demo"}, "run-1")
+	var notSubmitted *runner.NotSubmittedError
+	if !errors.As(err, &notSubmitted) {
+		t.Errorf("expected failure before submission, got %v", err)
+	}
+}
+
+func TestPollGivesUp(t *testing.T) {
+	s, nc, _ := newTestService(t, Slurm, map[string]string{
+		"status": `echo "slurm_load_jobs error: Unable to contact slurm controller" >&2; exit 1`,
+	})
+
+	sub, err := nc.SubscribeSync(runs.FinishedSubject("run-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Poll("run-1", "42", false)
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status model.RunStatus
+	err = json.Unmarshal(msg.Data, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != model.RunStateFailed || status.Error == nil || !strings.Contains(*status.Error, "Unable to contact slurm controller") {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestStop(t *testing.T) {
+	s, _, _ := newTestService(t, PBS, map[string]string{
+		"status": `echo "Job Id: $2"; echo "    job_state = R"`,
+		"cancel": `echo "$@" > "$(dirname "$0")/cancelled"`,
+	})
+
+	err := s.Stop(runner.StopConfig{ProcessId: "7.pbs-server", RunName: "run-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, err := os.ReadFile(filepath.Join(filepath.Dir(s.config.CancelBinPath), "cancelled"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(cancelled)) != "7.pbs-server" {
+		t.Errorf("expected job to be cancelled, got %q", cancelled)
+	}
+}
+
+func TestStopFinishedJob(t *testing.T) {
+	s, _, _ := newTestService(t, Slurm, map[string]string{
+		"status": `echo COMPLETED`,
+		"cancel": `exit 1`,
+	})
+
+	err := s.Stop(runner.StopConfig{ProcessId: "42"})
+	if !errors.Is(err, runner.ErrAlreadyFinished) {
+		t.Fatalf("expected ErrAlreadyFinished, got %v", err)
+	}
+
+	err = s.Stop(runner.StopConfig{ProcessId: "42; rm -rf /"})
+	if err == nil {
+		t.Fatal("expected invalid job id to be rejected")
+	}
+}
+
+func TestAlive(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{status: `echo RUNNING`, want: true},
+		{status: `echo COMPLETED`, want: false},
+	}
+
+	for _, tt := range tests {
+		s, _, _ := newTestService(t, Slurm, map[string]string{"status": tt.status})
+
+		alive, err := s.Alive(context.Background(), "42")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alive != tt.want {
+			t.Errorf("%s: Alive() = %v, want %v", tt.status, alive, tt.want)
+		}
+	}
+}
+
+func TestJobScriptQuoting(t *testing.T) {
+	dir := t.TempDir()
+	script := jobScript(dir, []string{"printf", "%s|", "a b", "it's", "$HOME", "`id`"})
+
+	err := os.WriteFile(filepath.Join(dir, scriptFile), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exec.Command("bash", filepath.Join(dir, scriptFile)).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := os.ReadFile(filepath.Join(dir, stdoutFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stdout) != "a b|it's|$HOME|`id`|" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+
+	exitCode, err := os.ReadFile(filepath.Join(dir, exitCodeFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(exitCode)) != "0" {
+		t.Errorf("unexpected exit code: %q", exitCode)
+	}
+}
+
+func TestParseJobID(t *testing.T) {
+	slurm := &Service{config: Config{Scheduler: Slurm, SubmitBinPath: "sbatch"}}
+	pbs := &Service{config: Config{Scheduler: PBS, SubmitBinPath: "qsub"}}
+
+	tests := []struct {
+		s      *Service
+		output string
+		want   string
+	}{
+		{slurm, "42\n", "42"},
+		{slurm, "42;cluster\n", "42"},
+		{pbs, "7.pbs-server\n", "7.pbs-server"},
+		{pbs, "12[].pbs-server\n", "12[].pbs-server"},
+	}
+	for _, tt := range tests {
+		got, err := tt.s.parseJobID(tt.output)
+		if err != nil || got != tt.want {
+			t.Errorf("parseJobID(%q) = %q, %v, want %q", tt.output, got, err, tt.want)
+		}
+	}
+
+	_, err := slurm.parseJobID("sbatch: error: invalid partition\n")
+	if err == nil {
+		t.Error("expected error for output without job id")
+	}
+}
@@ -0,0 +1,303 @@
+package hpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/runs"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second
+
+	// consecutive failed polls after which the job is given up on
+	maxPollFailures = 30
+
+	// polls a job has to be missing from the queue before it is considered
+	// lost, the exit code file may show up late on shared file systems
+	maxGonePolls = 3
+
+	// number of stderr lines kept for the run status
+	stderrTailLines = 20
+)
+
+// job output files and the stream their lines are published as, in the
+// order they are published
+var logFiles = []struct {
+	file   string
+	stream model.LogStream
+}{
+	{stdoutFile, model.LogStreamStdout},
+	{stderrFile, model.LogStreamStderr},
+}
+
+type poller struct {
+	s       *Service
+	jobID   string
+	runName string
+	runDir  string
+	state   string
+	// bytes of each output file already published
+	offsets    map[string]int64
+	stderrTail []string
+	failures   int
+	gonePolls  int
+}
+
+// Poll follows a submitted job, publishing its state changes and output to
+// the run's log stream until the job ends. Existing output is skipped when
+// resuming a job after a worker restart.
+func (s *Service) Poll(runName string, jobID string, resumed bool) {
+	p := &poller{
+		s:       s,
+		jobID:   jobID,
+		runName: runName,
+		runDir:  s.LaunchDir(runName),
+		offsets: make(map[string]int64),
+	}
+
+	go p.run(resumed)
+}
+
+func (p *poller) run(resumed bool) {
+	ctx := context.Background()
+	startedAt := time.Now()
+
+	interval := p.s.config.PollInterval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+
+	if resumed {
+		p.skipLogs()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		done, err := p.poll(ctx)
+		if err != nil {
+			p.failures++
+			p.s.Logger.Info("hpc poll failed", "job_id", p.jobID, "failures", p.failures, "error", err)
+			if p.failures >= maxPollFailures {
+				p.abandon(startedAt, resumed, fmt.Sprintf("Stopped following %s job %s after %d failed polls: %v", p.s.config.Scheduler, p.jobID, p.failures, err))
+				return
+			}
+		} else {
+			p.failures = 0
+		}
+
+		if done {
+			p.finish(startedAt, resumed)
+			return
+		}
+
+		<-ticker.C
+	}
+}
+
+// poll publishes new state and output lines, reporting whether the job ended
+func (p *poller) poll(ctx context.Context) (bool, error) {
+	err := p.publishLogs(false)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(filepath.Join(p.runDir, exitCodeFile)); err == nil {
+		return true, nil
+	}
+
+	state, active, err := p.s.jobState(ctx, p.jobID)
+	if err != nil {
+		return false, err
+	}
+
+	if state != p.state {
+		p.state = state
+		p.publish(model.Log{Message: fmt.Sprintf("%s job %s state: %s", p.s.config.Scheduler, p.jobID, state)})
+	}
+
+	if active {
+		p.gonePolls = 0
+		return false, nil
+	}
+
+	p.gonePolls++
+	return p.gonePolls >= maxGonePolls, nil
+}
+
+// publishLogs publishes the complete lines written since the last poll,
+// a trailing partial line is only published when flush is set
+func (p *poller) publishLogs(flush bool) error {
+	for _, log := range logFiles {
+		file, stream := log.file, log.stream
+		data, err := p.read(file)
+		if err != nil {
+			return err
+		}
+
+		end := len(data)
+		if !flush {
+			end = strings.LastIndexByte(string(data), '\n') + 1
+		}
+		if end == 0 {
+			continue
+		}
+
+		text := strings.TrimSuffix(string(data[:end]), "\n")
+		for _, line := range strings.Split(text, "\n") {
+			if stream == model.LogStreamStderr {
+				p.addStderr(line)
+			}
+			p.publish(model.Log{Message: line, Stream: stream})
+		}
+		p.offsets[file] += int64(end)
+	}
+
+	return nil
+}
+
+// read returns the bytes of an output file after its offset
+func (p *poller) read(file string) ([]byte, error) {
+	f, err := os.Open(filepath.Join(p.runDir, file))
+	if os.IsNotExist(err) {
+		// job has not started yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < p.offsets[file] {
+		// file was truncated, e.g. by a requeued job
+		p.offsets[file] = 0
+	}
+
+	_, err = f.Seek(p.offsets[file], io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+func (p *poller) skipLogs() {
+	for _, log := range logFiles {
+		file := log.file
+		info, err := os.Stat(filepath.Join(p.runDir, file))
+		if err == nil {
+			p.offsets[file] = info.Size()
+		}
+	}
+}
+
+func (p *poller) addStderr(line string) {
+	p.stderrTail = append(p.stderrTail, line)
+	if len(p.stderrTail) > stderrTailLines {
+		p.stderrTail = p.stderrTail[len(p.stderrTail)-stderrTailLines:]
+	}
+}
+
+func (p *poller) publish(log model.Log) {
+	err := logstream.PublishLog(p.s.Js, p.runName, log)
+	if err != nil {
+		p.s.Logger.Error("Failed to publish log", "error", err)
+	}
+}
+
+func (p *poller) finish(startedAt time.Time, resumed bool) {
+	err := p.publishLogs(true)
+	if err != nil {
+		p.s.Logger.Info("failed to read job output", "job_id", p.jobID, "error", err)
+	}
+
+	finishedAt := time.Now().UTC().Format(time.RFC3339)
+	status := model.RunStatus{
+		RunName:    p.runName,
+		ProcessKey: &p.jobID,
+		State:      model.RunStateFailed,
+		StderrTail: append([]string{}, p.stderrTail...),
+		FinishedAt: &finishedAt,
+	}
+	if !resumed {
+		seconds := time.Since(startedAt).Seconds()
+		status.DurationSeconds = &seconds
+	}
+
+	exitCode, err := p.exitCode()
+	if err != nil {
+		// the job was killed before nextflow returned
+		p.publish(model.Log{
+			Message: fmt.Sprintf("%s job %s ended without an exit code: %v", p.s.config.Scheduler, p.jobID, err),
+			Level:   model.LogLevelError,
+		})
+	} else {
+		setExitCode(&status, exitCode)
+	}
+
+	err = runs.PublishFinished(p.s.Nc, status)
+	if err != nil {
+		p.s.Logger.Error("Failed to publish run status", "error", err)
+	}
+}
+
+// abandon reports the run failed when its job can no longer be followed,
+// otherwise it would stay running and hold its queue slot
+func (p *poller) abandon(startedAt time.Time, resumed bool, cause string) {
+	p.publish(model.Log{Message: cause, Level: model.LogLevelError})
+
+	finishedAt := time.Now().UTC().Format(time.RFC3339)
+	status := model.RunStatus{
+		RunName:    p.runName,
+		ProcessKey: &p.jobID,
+		State:      model.RunStateFailed,
+		StderrTail: append([]string{}, p.stderrTail...),
+		Error:      &cause,
+		FinishedAt: &finishedAt,
+	}
+	if !resumed {
+		seconds := time.Since(startedAt).Seconds()
+		status.DurationSeconds = &seconds
+	}
+
+	err := runs.PublishFinished(p.s.Nc, status)
+	if err != nil {
+		p.s.Logger.Error("Failed to publish run status", "error", err)
+	}
+}
+
+func (p *poller) exitCode() (int, error) {
+	data, err := os.ReadFile(filepath.Join(p.runDir, exitCodeFile))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// setExitCode records the exit code of nextflow, bash reports processes
+// killed by a signal as 128 plus the signal number
+func setExitCode(status *model.RunStatus, exitCode int) {
+	if exitCode > 128 && exitCode < 128+65 {
+		signal := syscall.Signal(exitCode - 128).String()
+		status.Signal = &signal
+		return
+	}
+
+	status.ExitCode = &exitCode
+	if exitCode == 0 {
+		status.State = model.RunStateSucceeded
+	}
+}
@@ -0,0 +1,105 @@
+package hpc
+
+import (
+	"context"
+	"fmt"
+	"nf-shard-orchestrator/pkg/runner"
+	"strings"
+)
+
+// stateGone is reported for jobs the scheduler no longer lists
+const stateGone = "no longer queued"
+
+// slurm states of jobs that ended, squeue lists them for a short while
+var slurmFinishedStates = map[string]bool{
+	"BOOT_FAIL":     true,
+	"CANCELLED":     true,
+	"COMPLETED":     true,
+	"DEADLINE":      true,
+	"FAILED":        true,
+	"NODE_FAIL":     true,
+	"OUT_OF_MEMORY": true,
+	"PREEMPTED":     true,
+	"TIMEOUT":       true,
+}
+
+// PBS job states of completed (torque) and finished (PBS Pro) jobs
+var pbsFinishedStates = map[string]bool{
+	"C": true,
+	"F": true,
+}
+
+// errors of the status commands for jobs that are not known
+var unknownJobErrors = []string{
+	"Invalid job id",
+	"Unknown Job Id",
+	"Job has finished",
+}
+
+func unknownJob(output string) bool {
+	for _, e := range unknownJobErrors {
+		if strings.Contains(output, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// jobState returns the scheduler state of a job and whether it is still
+// queued or running
+func (s *Service) jobState(ctx context.Context, jobID string) (string, bool, error) {
+	args := []string{"-h", "-j", jobID, "-o", "%T"}
+	if s.config.Scheduler == PBS {
+		args = []string{"-f", jobID}
+	}
+
+	output, err := s.command(ctx, s.config.StatusBinPath, args...)
+	if err != nil {
+		if unknownJob(output) {
+			return stateGone, false, nil
+		}
+		return "", false, err
+	}
+
+	if s.config.Scheduler == PBS {
+		state := extractField(output, "job_state")
+		if state == "" {
+			return stateGone, false, nil
+		}
+		return state, !pbsFinishedStates[state], nil
+	}
+
+	state, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	if state == "" {
+		return stateGone, false, nil
+	}
+	return state, !slurmFinishedStates[state], nil
+}
+
+// extractField returns the value of a `key = value` line of qstat -f
+func extractField(output string, key string) string {
+	for _, line := range strings.Split(output, "\n") {
+		k, v, found := strings.Cut(line, "=")
+		if found && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// jobScript runs nextflow in the launch directory, with the pipeline pulled
+// into it, and records its exit code, the file is renamed into place so it
+// is never read half written
+func jobScript(runDir string, nfArgs []string) string {
+	quoted := make([]string, len(nfArgs))
+	for i, arg := range nfArgs {
+		quoted[i] = runner.ShellQuote(arg)
+	}
+
+	return fmt.Sprintf(`#!/bin/bash
+cd %s || exit 1
+export NXF_ASSETS=%s
+%s > %s 2> %s
+echo $? > %s.tmp && mv %s.tmp %s
+`, runner.ShellQuote(runDir), runner.ShellQuote(runner.AssetsDir(runDir)), strings.Join(quoted, " "), stdoutFile, stderrFile, exitCodeFile, exitCodeFile, exitCodeFile)
+}
@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	requestTimeout    = 30 * time.Second
+)
+
+// client is a minimal Kubernetes API client covering the few calls the
+// runner needs
+type client struct {
+	apiServer string
+	token     string
+	http      *http.Client
+}
+
+func newClient(c Config) (*client, error) {
+	apiServer := c.APIServer
+	token := c.Token
+	caFile := c.CAFile
+
+	// fall back to the in-cluster service account
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("kubernetes API server not configured and not running in a cluster")
+		}
+		apiServer = "https://" + net.JoinHostPort(host, port)
+	}
+	if token == "" {
+		data, err := os.ReadFile(serviceAccountDir + "/token")
+		if err == nil {
+			token = strings.TrimSpace(string(data))
+		}
+	}
+	if caFile == "" {
+		if _, err := os.Stat(serviceAccountDir + "/ca.crt"); err == nil {
+			caFile = serviceAccountDir + "/ca.crt"
+		}
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: requestTimeout}
+
+		if caFile != "" {
+			ca, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read kubernetes CA: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("invalid kubernetes CA in %s", caFile)
+			}
+			httpClient.Transport = &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			}
+		}
+	}
+
+	return &client{
+		apiServer: strings.TrimRight(apiServer, "/"),
+		token:     token,
+		http:      httpClient,
+	}, nil
+}
+
+func (c *client) do(ctx context.Context, method string, path string, query url.Values) (int, error) {
+	u := c.apiServer + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("kubernetes %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("kubernetes %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return resp.StatusCode, nil
+}
+
+// exists reports whether the object at path can be read
+func (c *client) exists(ctx context.Context, path string) (bool, error) {
+	status, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return false, err
+	}
+	return status != http.StatusNotFound, nil
+}
+
+func (c *client) deletePods(ctx context.Context, namespace string, labelSelector string) error {
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods", namespace)
+	_, err := c.do(ctx, http.MethodDelete, path, url.Values{"labelSelector": {labelSelector}})
+	return err
+}
@@ -0,0 +1,200 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runner/nextflow"
+	"path"
+	"regexp"
+	"time"
+)
+
+var (
+	_ runner.Runner      = &Service{}
+	_ runner.Validator   = &Service{}
+	_ runner.LaunchDirer = &Service{}
+)
+
+// RunLabel is attached to every task pod of a run
+const RunLabel = "nf-shard/run-name"
+
+const defaultMountPath = "/workspace"
+
+// object names must be DNS labels or subdomains
+var nameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+var mountPathRegex = regexp.MustCompile(`^/[-_./a-zA-Z0-9]*$`)
+
+// run names become the value of RunLabel
+var labelValueRegex = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+
+const maxLabelValueLength = 63
+
+type Config struct {
+	Logger   *slog.Logger
+	Nextflow *nextflow.Service
+
+	Namespace        string
+	ServiceAccount   string
+	StorageClaim     string
+	StorageMountPath string
+
+	// APIServer, Token and CAFile default to the in-cluster service account
+	APIServer  string
+	Token      string
+	CAFile     string
+	HTTPClient *http.Client
+}
+
+func (c Config) Validate() error {
+	for name, value := range map[string]string{
+		"namespace":       c.Namespace,
+		"service account": c.ServiceAccount,
+		"storage claim":   c.StorageClaim,
+	} {
+		if !nameRegex.MatchString(value) {
+			return fmt.Errorf("invalid kubernetes %s: %q", name, value)
+		}
+	}
+	if c.StorageMountPath != "" && !mountPathRegex.MatchString(c.StorageMountPath) {
+		return fmt.Errorf("invalid kubernetes storage mount path: %q", c.StorageMountPath)
+	}
+	return nil
+}
+
+// Service runs the nextflow head process on the worker and its tasks as
+// pods in the configured namespace
+type Service struct {
+	config Config
+	Logger *slog.Logger
+	nf     *nextflow.Service
+	client *client
+}
+
+func NewRunner(c Config) (*Service, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if c.StorageMountPath == "" {
+		c.StorageMountPath = defaultMountPath
+	}
+
+	cl, err := newClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{
+		config: c,
+		Logger: c.Logger,
+		nf:     c.Nextflow,
+		client: cl,
+	}, nil
+}
+
+func (s *Service) k8sConfig(runName string) string {
+	return fmt.Sprintf(`
+process {
+    executor = 'k8s'
+}
+
+k8s {
+    namespace = '%s'
+    serviceAccount = '%s'
+    storageClaimName = '%s'
+    storageMountPath = '%s'
+    pod = [[label: '%s', value: '%s']]
+}
+`, s.config.Namespace, s.config.ServiceAccount, s.config.StorageClaim, s.config.StorageMountPath, RunLabel, runName)
+}
+
+func hasWorkDir(args []string) bool {
+	for _, arg := range args {
+		if arg == "-work-dir" || arg == "-bucket-dir" {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the namespace, service account and storage claim
+// the runs depend on exist.
+func (s *Service) Validate(ctx context.Context, run runner.RunConfig) error {
+	ns := s.config.Namespace
+	objects := []struct {
+		kind string
+		path string
+	}{
+		{"namespace", fmt.Sprintf("/api/v1/namespaces/%s", ns)},
+		{"service account", fmt.Sprintf("/api/v1/namespaces/%s/serviceaccounts/%s", ns, s.config.ServiceAccount)},
+		{"storage claim", fmt.Sprintf("/api/v1/namespaces/%s/persistentvolumeclaims/%s", ns, s.config.StorageClaim)},
+	}
+
+	for _, o := range objects {
+		exists, err := s.client.exists(ctx, o.path)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("kubernetes %s %s not found", o.kind, path.Base(o.path))
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) Execute(ctx context.Context, run runner.RunConfig, runName string) (string, error) {
+	// the task pods of a run are found and cleaned up by its label
+	if len(runName) > maxLabelValueLength || !labelValueRegex.MatchString(runName) {
+		return "", runner.NotSubmitted(fmt.Errorf("run name %q is not a valid kubernetes label value", runName))
+	}
+
+	// tasks can only reach the work dir through the storage claim
+	if !hasWorkDir(run.Args) {
+		run.Args = append(run.Args, "-work-dir", path.Join(s.config.StorageMountPath, runName, "work"))
+	}
+	run.ConfigOverride += s.k8sConfig(runName)
+
+	return s.nf.Execute(ctx, run, runName)
+}
+
+// Stop stops the head process and deletes the task pods it leaves behind.
+func (s *Service) Stop(c runner.StopConfig) error {
+	stopErr := s.nf.Stop(c)
+	if stopErr != nil {
+		s.Logger.Info("Failed to stop nextflow head process", "error", stopErr)
+	}
+
+	if c.RunName == "" {
+		return errors.Join(stopErr, fmt.Errorf("run name required to clean up pods"))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err := s.client.deletePods(ctx, s.config.Namespace, fmt.Sprintf("%s=%s", RunLabel, c.RunName))
+	if err != nil {
+		s.Logger.Error("Failed to delete run pods", "run_name", c.RunName, "error", err)
+	}
+
+	return errors.Join(stopErr, err)
+}
+
+// Alive reports whether the nextflow head process of a run still exists,
+// its task pods are cleaned up by Stop
+func (s *Service) Alive(ctx context.Context, processKey string) (bool, error) {
+	return s.nf.Alive(ctx, processKey)
+}
+
+// LaunchDir is the directory the nextflow head process of a run is started in
+func (s *Service) LaunchDir(runName string) string {
+	return s.nf.LaunchDir(runName)
+}
+
+func (s *Service) BinPath() string {
+	return s.nf.BinPath()
+}
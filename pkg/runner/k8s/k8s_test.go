@@ -0,0 +1,160 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runner/nextflow"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeAPI struct {
+	mu       sync.Mutex
+	objects  map[string]bool
+	requests []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.RequestURI())
+
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		w.Write([]byte(`{"kind":"PodList"}`))
+		return
+	}
+	if !f.objects[r.URL.Path] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Write([]byte(`{}`))
+}
+
+func newTestService(t *testing.T, api *fakeAPI) *Service {
+	t.Helper()
+
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	logger := slog.New(slog.NewTextHandler(&strings.Builder{}, nil))
+	s, err := NewRunner(Config{
+		Logger:         logger,
+		Nextflow:       nextflow.NewRunner(nextflow.Config{Logger: logger}),
+		Namespace:      "pipelines",
+		ServiceAccount: "nextflow",
+		StorageClaim:   "nf-work",
+		APIServer:      server.URL,
+		Token:          "test-token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{Namespace: "pipelines", ServiceAccount: "nextflow", StorageClaim: "nf-work"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	invalid := []Config{
+		{ServiceAccount: "nextflow", StorageClaim: "nf-work"},
+		{Namespace: "Pipelines", ServiceAccount: "nextflow", StorageClaim: "nf-work"},
+		{Namespace: "pipelines", ServiceAccount: "next'flow", StorageClaim: "nf-work"},
+		{Namespace: "pipelines", ServiceAccount: "nextflow", StorageClaim: "nf-work", StorageMountPath: "workspace"},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", c)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	api := &fakeAPI{objects: map[string]bool{
+		"/api/v1/namespaces/pipelines":                                true,
+		"/api/v1/namespaces/pipelines/serviceaccounts/nextflow":       true,
+		"/api/v1/namespaces/pipelines/persistentvolumeclaims/nf-work": true,
+	}}
+	s := newTestService(t, api)
+
+	if err := s.Validate(context.Background(), runner.RunConfig{}); err != nil {
+		t.Fatalf("expected validation to pass, got %v", err)
+	}
+
+	delete(api.objects, "/api/v1/namespaces/pipelines/persistentvolumeclaims/nf-work")
+	err := s.Validate(context.Background(), runner.RunConfig{})
+	if err == nil || !strings.Contains(err.Error(), "storage claim nf-work not found") {
+		t.Fatalf("expected missing storage claim error, got %v", err)
+	}
+}
+
+func TestStopDeletesRunPods(t *testing.T) {
+	api := &fakeAPI{}
+	s := newTestService(t, api)
+
+	head := exec.Command("sleep", "30")
+	if err := head.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// reaped like the nextflow runner does
+	exited := runner.TrackProcess(head.Process.Pid)
+	go func() {
+		_ = head.Wait()
+		exited()
+	}()
+
+	err := s.Stop(runner.StopConfig{
+		ProcessId: strconv.Itoa(head.Process.Pid),
+		RunName:   "run-1",
+	})
+	if err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	want := "DELETE /api/v1/namespaces/pipelines/pods?labelSelector=nf-shard%2Frun-name%3Drun-1"
+	if len(api.requests) != 1 || api.requests[0] != want {
+		t.Fatalf("expected %q, got %v", want, api.requests)
+	}
+}
+
+func TestK8sConfig(t *testing.T) {
+	s := newTestService(t, &fakeAPI{})
+
+	config := s.k8sConfig("run-1")
+	for _, want := range []string{
+		"executor = 'k8s'",
+		"namespace = 'pipelines'",
+		"storageMountPath = '/workspace'",
+		"pod = [[label: 'nf-shard/run-name', value: 'run-1']]",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("expected config to contain %q:\n%s", want, config)
+		}
+	}
+}
+
+func TestExecuteInvalidLabel(t *testing.T) {
+	s := newTestService(t, &fakeAPI{})
+
+	for _, runName := range []string{"-run", "run_", strings.Repeat("r", 64)} {
+		_, err := s.Execute(context.Background(), runner.RunConfig{}, runName)
+		var notSubmitted *runner.NotSubmittedError
+		if !errors.As(err, &notSubmitted) {
+			t.Errorf("Execute(%q) error = %v, want not submitted", runName, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runner/nextflow"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	_ runner.Runner      = &Service{}
+	_ runner.LaunchDirer = &Service{}
+)
+
+var memoryRegex = regexp.MustCompile(`^\d+(\.\d+)?\s*(B|KB|MB|GB|TB)$`)
+
+type Config struct {
+	Logger   *slog.Logger
+	Nextflow *nextflow.Service
+	// BaseDir holds a working directory per run
+	BaseDir string
+	// MaxCpus and MaxMemory cap the resources used by all tasks of a run,
+	// MaxMemory uses nextflow memory units, e.g. `8 GB`. Empty values leave
+	// the nextflow defaults in place.
+	MaxCpus   int
+	MaxMemory string
+}
+
+func (c Config) Validate() error {
+	if c.BaseDir == "" {
+		return fmt.Errorf("base directory not set")
+	}
+	if c.MaxCpus < 0 {
+		return fmt.Errorf("invalid cpu limit: %d", c.MaxCpus)
+	}
+	if c.MaxMemory != "" && !memoryRegex.MatchString(c.MaxMemory) {
+		return fmt.Errorf("invalid memory limit: %q", c.MaxMemory)
+	}
+	return nil
+}
+
+// Service runs pipelines on the worker host itself, for development and CI
+type Service struct {
+	config Config
+	Logger *slog.Logger
+	nf     *nextflow.Service
+}
+
+func NewRunner(c Config) *Service {
+	return &Service{
+		config: c,
+		Logger: c.Logger,
+		nf:     c.Nextflow,
+	}
+}
+
+// localConfig is appended to the config override so it takes precedence
+// over executor settings of the user
+func (s *Service) localConfig() string {
+	var limits strings.Builder
+	if s.config.MaxCpus > 0 {
+		fmt.Fprintf(&limits, "\n        cpus = %d", s.config.MaxCpus)
+	}
+	if s.config.MaxMemory != "" {
+		fmt.Fprintf(&limits, "\n        memory = '%s'", s.config.MaxMemory)
+	}
+
+	return fmt.Sprintf(`
+process {
+    executor = 'local'
+}
+
+executor {
+    $local {%s
+    }
+}
+`, limits.String())
+}
+
+// LaunchDir is the directory the nextflow head process of a run is started in
+func (s *Service) LaunchDir(runName string) string {
+	return s.nf.LaunchDir(runName)
+}
+
+func (s *Service) WorkDir(runName string) string {
+	return filepath.Join(s.config.BaseDir, runName, "work")
+}
+
+func (s *Service) Execute(ctx context.Context, run runner.RunConfig, runName string) (string, error) {
+	workDir := s.WorkDir(runName)
+	err := os.MkdirAll(workDir, 0755)
+	if err != nil {
+		s.Logger.Error("Failed to create work directory", "error", err)
+		return "", runner.NotSubmitted(err)
+	}
+
+	run = run.RemoveWorkDir()
+	run.Args = append(run.Args, "-work-dir", workDir)
+	run.ConfigOverride += s.localConfig()
+
+	return s.nf.Execute(ctx, run, runName)
+}
+
+func (s *Service) Stop(c runner.StopConfig) error {
+	return s.nf.Stop(c)
+}
+
+func (s *Service) Alive(ctx context.Context, processKey string) (bool, error) {
+	return s.nf.Alive(ctx, processKey)
+}
+
+func (s *Service) BinPath() string {
+	return s.nf.BinPath()
+}
@@ -0,0 +1,194 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/natstest"
+	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runner/nextflow"
+	"nf-shard-orchestrator/pkg/runs"
+	logstream "nf-shard-orchestrator/pkg/streamlogs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		config Config
+		valid  bool
+	}{
+		{Config{BaseDir: "/runs"}, true},
+		{Config{BaseDir: "/runs", MaxCpus: 4, MaxMemory: "8 GB"}, true},
+		{Config{BaseDir: "/runs", MaxMemory: "1.5GB"}, true},
+		{Config{}, false},
+		{Config{BaseDir: "/runs", MaxCpus: -1}, false},
+		{Config{BaseDir: "/runs", MaxMemory: "8"}, false},
+		{Config{BaseDir: "/runs", MaxMemory: "8 GB'; evil"}, false},
+	}
+
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.config, err, tt.valid)
+		}
+	}
+}
+
+func TestLocalConfig(t *testing.T) {
+	s := NewRunner(Config{BaseDir: "/runs"})
+	config := s.localConfig()
+	if !strings.Contains(config, "executor = 'local'") {
+		t.Errorf("expected the local executor to be forced, got %s", config)
+	}
+	if strings.Contains(config, "cpus") || strings.Contains(config, "memory") {
+		t.Errorf("expected no limits, got %s", config)
+	}
+
+	s = NewRunner(Config{BaseDir: "/runs", MaxCpus: 4, MaxMemory: "8 GB"})
+	config = s.localConfig()
+	for _, want := range []string{"executor = 'local'", "$local {", "cpus = 4", "memory = '8 GB'"} {
+		if !strings.Contains(config, want) {
+			t.Errorf("expected %q in %s", want, config)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	nc, js := natstest.Start(t)
+	_, err := logstream.CreateStream(context.Background(), js, time.Hour, logstream.DefaultMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// records its arguments and the config override it was given
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "nextflow")
+	script := `#!/bin/bash
+echo "$@" > "$PWD/args"
+while [ $# -gt 0 ]; do [ "$1" = "-c" ] && cp "$2" "$PWD/config"; shift; done
+`
+	err = os.WriteFile(bin, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	nf := nextflow.NewRunner(nextflow.Config{
+		Logger:  logger,
+		Wg:      &sync.WaitGroup{},
+		BinPath: bin,
+		Js:      js,
+		Nc:      nc,
+		BaseDir: filepath.Join(dir, "launch"),
+	})
+	s := NewRunner(Config{
+		Logger:   logger,
+		Nextflow: nf,
+		BaseDir:  filepath.Join(dir, "runs"),
+		MaxCpus:  2,
+	})
+
+	sub, err := nc.SubscribeSync(runs.FinishedSubject("run-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := runner.RunConfig{
+		PipelineUrl:    "nf-core/demo",
+		ConfigOverride: "process.executor = 'awsbatch'",
+		Args:           []string{"-name", "run-1", "-work-dir", "s3://bucket/work"},
+	}
+	_, err = s.Execute(context.Background(), run, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := s.WorkDir("run-1")
+	if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+		t.Errorf("expected work dir %s to be created: %v", workDir, err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(s.LaunchDir("run-1"), "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "-work-dir "+workDir) || strings.Contains(string(args), "s3://bucket/work") {
+		t.Errorf("expected only the local work dir in %s", args)
+	}
+
+	config, err := os.ReadFile(filepath.Join(s.LaunchDir("run-1"), "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the local executor comes last so it overrides the user's
+	override := strings.Index(string(config), "'awsbatch'")
+	local := strings.Index(string(config), "executor = 'local'")
+	if override < 0 || local < override || !strings.Contains(string(config), "cpus = 2") {
+		t.Errorf("unexpected config %s", config)
+	}
+}
+
+func TestStop(t *testing.T) {
+	nc, js := natstest.Start(t)
+	_, err := logstream.CreateStream(context.Background(), js, time.Hour, logstream.DefaultMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "nextflow")
+	err = os.WriteFile(bin, []byte("#!/bin/bash\nexec sleep 30\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	nf := nextflow.NewRunner(nextflow.Config{
+		Logger:  logger,
+		Wg:      &sync.WaitGroup{},
+		BinPath: bin,
+		Js:      js,
+		Nc:      nc,
+		BaseDir: filepath.Join(dir, "launch"),
+	})
+	s := NewRunner(Config{Logger: logger, Nextflow: nf, BaseDir: filepath.Join(dir, "runs")})
+
+	sub, err := nc.SubscribeSync(runs.FinishedSubject("run-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := s.Execute(context.Background(), runner.RunConfig{PipelineUrl: "nf-core/demo"}, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Stop(runner.StopConfig{ProcessId: pid, RunName: "run-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status model.RunStatus
+	err = json.Unmarshal(msg.Data, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the exit status of a stopped run is kept
+	if status.State != model.RunStateFailed || status.Signal == nil || *status.Signal != "terminated" {
+		t.Errorf("status = %+v, want FAILED by SIGTERM", status)
+	}
+}
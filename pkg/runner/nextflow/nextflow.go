@@ -8,95 +8,117 @@ import (
 	"github.com/nats-io/nats.go/jetstream"
 	"log/slog"
 	"nf-shard-orchestrator/graph/model"
-	"nf-shard-orchestrator/pkg/cache"
 	"nf-shard-orchestrator/pkg/runner"
+	"nf-shard-orchestrator/pkg/runs"
 	logstream "nf-shard-orchestrator/pkg/streamlogs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 )
 
-var _ runner.Runner = &Service{}
+var (
+	_ runner.Runner      = &Service{}
+	_ runner.LaunchDirer = &Service{}
+)
+
+// config override of a run, written to its launch directory
+const configFile = "injected.config"
 
 type Config struct {
-	Logger   *slog.Logger
-	Wg       *sync.WaitGroup
-	BinPath  string
-	Js       jetstream.JetStream
-	Nc       *nats.Conn
-	LogCache *cache.Cache[model.Log]
+	Logger  *slog.Logger
+	Wg      *sync.WaitGroup
+	BinPath string
+	Js      jetstream.JetStream
+	Nc      *nats.Conn
+	// BaseDir holds the launch directory of every run, with its nextflow
+	// history, logs and pipeline checkout
+	BaseDir string
 }
 
 type Service struct {
-	Config   Config
-	Wg       *sync.WaitGroup
-	Logger   *slog.Logger
-	Js       jetstream.JetStream
-	Nc       *nats.Conn
-	LogCache *cache.Cache[model.Log]
+	Config Config
+	Wg     *sync.WaitGroup
+	Logger *slog.Logger
+	Js     jetstream.JetStream
+	Nc     *nats.Conn
 }
 
 func NewRunner(c Config) *Service {
 	return &Service{
-		Config:   c,
-		Wg:       c.Wg,
-		Logger:   c.Logger,
-		Js:       c.Js,
-		Nc:       c.Nc,
-		LogCache: c.LogCache,
+		Config: c,
+		Wg:     c.Wg,
+		Logger: c.Logger,
+		Js:     c.Js,
+		Nc:     c.Nc,
 	}
 }
 
-func injectConfigFile(configOverride string) (string, error) {
-	tempDir, err := os.MkdirTemp("", "float-runner-")
-	if err != nil {
-		return "", err
-	}
-	fileName := "injected.config"
-	filePath := filepath.Join(tempDir, fileName)
-	err = os.WriteFile(filePath, []byte(configOverride), 0644)
-	if err != nil {
-		return "", err
-	}
-	return filePath, nil
+// LaunchDir is the directory nextflow is started in for a run
+func (s *Service) LaunchDir(runName string) string {
+	return filepath.Join(s.Config.BaseDir, runName)
 }
 
 func (s *Service) Execute(bgCtx context.Context, run runner.RunConfig, runName string) (string, error) {
 	s.Wg.Add(1)
 	defer s.Wg.Done()
 
-	filePath, err := injectConfigFile(run.ConfigOverride)
+	launchDir := s.LaunchDir(runName)
+	err := os.MkdirAll(launchDir, 0755)
+	if err != nil {
+		s.Logger.Error("Failed to create launch directory", "error", err)
+		return "", runner.NotSubmitted(err)
+	}
+
+	filePath := filepath.Join(launchDir, configFile)
+	err = os.WriteFile(filePath, []byte(run.ConfigOverride), 0644)
 	if err != nil {
 		s.Logger.Error("Failed to inject config file", "error", err)
-		return "", err
+		return "", runner.NotSubmitted(err)
+	}
+
+	run, err = run.WriteParamsFile(launchDir)
+	if err != nil {
+		s.Logger.Error("Failed to write params file", "error", err)
+		return "", runner.NotSubmitted(err)
 	}
 
-	args := run.CmdArgs()
+	nextflowRunName := run.NextflowRunName()
+	if nextflowRunName == "" {
+		nextflowRunName = runName
+	}
+
+	args := append([]string{"-log", runner.LogFile(launchDir, nextflowRunName)}, run.CmdArgs()...)
 	args = append(args, "-c", filePath)
 
 	command := exec.Command(s.Config.BinPath, args...)
-	command.Env = os.Environ()
+	command.Dir = launchDir
+	command.Env = runner.Env(launchDir)
 
 	// Create pipes for stdout and stderr
 	stdout, err := command.StdoutPipe()
 	if err != nil {
 		s.Logger.Error("Failed to create stdout pipe", "error", err)
-		return "", err
+		return "", runner.NotSubmitted(err)
 	}
 	stderr, err := command.StderrPipe()
 	if err != nil {
 		s.Logger.Error("Failed to create stderr pipe", "error", err)
-		return "", err
+		return "", runner.NotSubmitted(err)
 	}
 
+	startedAt := time.Now()
 	err = command.Start()
 	if err != nil {
 		s.Logger.Error("Failed to start command", "error", err)
-		return "", err
+		return "", runner.NotSubmitted(err)
 	}
 
+	processKey := strconv.Itoa(command.Process.Pid)
+	exited := runner.TrackProcess(command.Process.Pid)
+
 	var wg sync.WaitGroup
 	wg.Add(2)
 
@@ -107,8 +129,9 @@ func (s *Service) Execute(bgCtx context.Context, run runner.RunConfig, runName s
 			text := scanner.Text()
 			msg := model.Log{
 				Message: text,
+				Stream:  model.LogStreamStdout,
 			}
-			err = logstream.PublishLog(s.Nc, runName, msg, s.LogCache)
+			err := logstream.PublishLog(s.Js, runName, msg)
 			if err != nil {
 				s.Logger.Error("Failed to publish log", "error", err)
 			}
@@ -117,29 +140,40 @@ func (s *Service) Execute(bgCtx context.Context, run runner.RunConfig, runName s
 		}
 	}()
 
+	stderrTail := newTail(stderrTailLines)
 	go func() {
 		defer wg.Done()
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
 			text := scanner.Text()
 			s.Logger.Error("Command error output", "stderr", text)
+			stderrTail.add(text)
 			msg := model.Log{
 				Message: text,
+				Stream:  model.LogStreamStderr,
 			}
-			_ = logstream.PublishLog(s.Nc, runName, msg, s.LogCache)
+			_ = logstream.PublishLog(s.Js, runName, msg)
 		}
 	}()
 
 	go func() {
-		defer os.RemoveAll(filepath.Dir(filePath))
-		err = command.Wait()
+		// pipes have to be drained before Wait closes them
+		wg.Wait()
+		err := command.Wait()
+		exited()
 		if err != nil {
 			s.Logger.Info("Command exited with error", "error", err)
 		}
-		wg.Wait()
+
+		status := exitStatus(runName, command.ProcessState, time.Since(startedAt), stderrTail.lines())
+		status.ProcessKey = &processKey
+		err = runs.PublishFinished(s.Nc, status)
+		if err != nil {
+			s.Logger.Error("Failed to publish run status", "error", err)
+		}
 	}()
 
-	return strconv.Itoa(command.Process.Pid), nil
+	return processKey, nil
 }
 
 func (s *Service) Stop(c runner.StopConfig) error {
@@ -157,6 +191,15 @@ func (s *Service) Stop(c runner.StopConfig) error {
 	return nil
 }
 
+// Alive reports whether the nextflow process of a run still exists
+func (s *Service) Alive(ctx context.Context, processKey string) (bool, error) {
+	pid, err := strconv.Atoi(processKey)
+	if err != nil {
+		return false, fmt.Errorf("invalid process ID: %s", processKey)
+	}
+	return runner.ProcessAlive(pid), nil
+}
+
 func (s *Service) BinPath() string {
 	return s.Config.BinPath
 }
@@ -0,0 +1,71 @@
+package nextflow
+
+import (
+	"nf-shard-orchestrator/graph/model"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// number of stderr lines kept for the run status
+const stderrTailLines = 20
+
+// tail keeps the last n lines written to it
+type tail struct {
+	mu    sync.Mutex
+	n     int
+	items []string
+}
+
+func newTail(n int) *tail {
+	return &tail{n: n}
+}
+
+func (t *tail) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.items = append(t.items, line)
+	if len(t.items) > t.n {
+		t.items = t.items[len(t.items)-t.n:]
+	}
+}
+
+func (t *tail) lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string{}, t.items...)
+}
+
+func exitStatus(runName string, state *os.ProcessState, duration time.Duration, stderrTail []string) model.RunStatus {
+	finishedAt := time.Now().UTC().Format(time.RFC3339)
+	seconds := duration.Seconds()
+
+	status := model.RunStatus{
+		RunName:         runName,
+		State:           model.RunStateFailed,
+		DurationSeconds: &seconds,
+		StderrTail:      stderrTail,
+		FinishedAt:      &finishedAt,
+	}
+
+	if state == nil {
+		return status
+	}
+
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		signal := ws.Signal().String()
+		status.Signal = &signal
+		return status
+	}
+
+	exitCode := state.ExitCode()
+	status.ExitCode = &exitCode
+	if exitCode == 0 {
+		status.State = model.RunStateSucceeded
+	}
+
+	return status
+}
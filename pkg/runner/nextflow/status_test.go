@@ -0,0 +1,72 @@
+package nextflow
+
+import (
+	"nf-shard-orchestrator/graph/model"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTail(t *testing.T) {
+	tail := newTail(2)
+	if lines := tail.lines(); len(lines) != 0 {
+		t.Errorf("lines of empty tail = %q", lines)
+	}
+
+	for _, line := range []string{"a", "b", "c"} {
+		tail.add(line)
+	}
+	lines := tail.lines()
+	if !reflect.DeepEqual(lines, []string{"b", "c"}) {
+		t.Errorf("lines = %q, want [b c]", lines)
+	}
+
+	// callers own the returned lines
+	lines[0] = "x"
+	if tail.lines()[0] != "b" {
+		t.Error("expected lines to be copied")
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		script   string
+		state    model.RunState
+		exitCode *int
+		signal   string
+	}{
+		{"exit 0", model.RunStateSucceeded, ptr(0), ""},
+		{"exit 3", model.RunStateFailed, ptr(3), ""},
+		{"kill -TERM $$", model.RunStateFailed, nil, "terminated"},
+	}
+
+	for _, tt := range tests {
+		cmd := exec.Command("sh", "-c", tt.script)
+		_ = cmd.Run()
+
+		status := exitStatus("run-1", cmd.ProcessState, 2*time.Second, []string{"boom"})
+		if status.RunName != "run-1" || status.State != tt.state {
+			t.Errorf("%s: status = %+v, want %s", tt.script, status, tt.state)
+		}
+		if !reflect.DeepEqual(status.ExitCode, tt.exitCode) {
+			t.Errorf("%s: exit code = %v, want %v", tt.script, status.ExitCode, tt.exitCode)
+		}
+		if (status.Signal == nil && tt.signal != "") || (status.Signal != nil && *status.Signal != tt.signal) {
+			t.Errorf("%s: signal = %v, want %q", tt.script, status.Signal, tt.signal)
+		}
+		if *status.DurationSeconds != 2 || status.FinishedAt == nil || !reflect.DeepEqual(status.StderrTail, []string{"boom"}) {
+			t.Errorf("%s: status = %+v", tt.script, status)
+		}
+	}
+
+	// a process that never started failed without an exit code
+	status := exitStatus("run-1", nil, 0, []string{})
+	if status.State != model.RunStateFailed || status.ExitCode != nil || status.Signal != nil {
+		t.Errorf("status without process = %+v", status)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,200 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// name of the nextflow log written by a preview
+const previewLogFile = "nextflow.log"
+
+var (
+	ansiRegex = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+	// processes started by the workflow, as logged and as shown by the
+	// progress output
+	startedProcessRegex = regexp.MustCompile(`Starting process > (\S+)`)
+	processLineRegex    = regexp.MustCompile(`process > (\S+)`)
+	// locations given by compilation and runtime errors
+	errorFileRegex       = regexp.MustCompile(`(?m)^- file : (\S+)`)
+	errorLineColumnRegex = regexp.MustCompile(`@ line (\d+), column (\d+)`)
+	checkScriptRegex     = regexp.MustCompile(`-- Check script '([^']+)' at line: (\d+)`)
+)
+
+// Preview is the outcome of running a pipeline with -preview
+type Preview struct {
+	Output string
+	// Log is the nextflow log of the preview
+	Log string
+	// Processes are the fully qualified names of the processes the
+	// workflow started, in order
+	Processes []string
+	Warnings  []string
+	// Err is set when nextflow failed, Error holds what it reported
+	Err   error
+	Error *PreviewError
+}
+
+// PreviewError is the error nextflow reported and the location in the
+// pipeline it points to, when it gave one
+type PreviewError struct {
+	Message string
+	File    string
+	Line    int
+	Column  int
+}
+
+// CanPreview reports whether the run can be previewed, workflows run with
+// -main-script can't be simulated
+func CanPreview(run RunConfig) bool {
+	return !slices.Contains(run.Args, "-main-script")
+}
+
+// RunPreview runs the pipeline with -preview on the local executor under
+// the given nextflow run name, which has to be unique. It is launched in
+// launchDir, so the run reuses the pipeline pulled by its preview, or in a
+// directory of its own when launchDir is empty. An error is only returned
+// when nextflow could not be run, a failing preview is reported in the
+// result.
+func RunPreview(ctx context.Context, logger *slog.Logger, run RunConfig, nextflowBinPath string, previewName string, launchDir string) (*Preview, error) {
+	run = run.SetRunName(previewName)
+
+	// for mocking work dir is nescessary
+	run = run.AddWorkDirIfNotExists()
+
+	tempDir, err := os.MkdirTemp("", "runner-")
+	if err != nil {
+		logger.Error("Failed to create temporary directory", "error", err)
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	if launchDir == "" {
+		launchDir = tempDir
+	}
+	err = os.MkdirAll(launchDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	run = run.Mock()
+
+	configFilePath := filepath.Join(tempDir, "injected.config")
+	err = os.WriteFile(configFilePath, []byte(run.ConfigOverride), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err = run.WriteParamsFile(tempDir)
+	if err != nil {
+		return nil, err
+	}
+
+	logPath := filepath.Join(tempDir, previewLogFile)
+	args := append([]string{"-log", logPath}, run.CmdArgs()...)
+	args = append(args, "-c", configFilePath)
+
+	command := exec.CommandContext(ctx, nextflowBinPath, args...)
+	command.Dir = launchDir
+	command.Env = Env(launchDir)
+	output, err := command.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
+	}
+
+	nextflowLog, logErr := os.ReadFile(logPath)
+	if logErr != nil && !os.IsNotExist(logErr) {
+		logger.Info("Failed to read nextflow log", "error", logErr)
+	}
+
+	preview := parsePreview(string(output), string(nextflowLog))
+	preview.Log = string(nextflowLog)
+	if err != nil {
+		preview.Err = err
+		if preview.Error == nil {
+			preview.Error = &PreviewError{Message: err.Error()}
+		}
+	}
+
+	return preview, nil
+}
+
+// parsePreview reads the processes, warnings and error from the console
+// output and log of a preview
+func parsePreview(output string, nextflowLog string) *Preview {
+	output = ansiRegex.ReplaceAllString(output, "")
+	preview := &Preview{
+		Output:    output,
+		Processes: []string{},
+		Warnings:  []string{},
+	}
+
+	addProcess := func(name string) {
+		if !slices.Contains(preview.Processes, name) {
+			preview.Processes = append(preview.Processes, name)
+		}
+	}
+	for _, match := range startedProcessRegex.FindAllStringSubmatch(nextflowLog, -1) {
+		addProcess(match[1])
+	}
+
+	lines := strings.Split(output, "\n")
+	errorAt := -1
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		lines[i] = line
+
+		if warning, ok := strings.CutPrefix(line, "WARN: "); ok && !slices.Contains(preview.Warnings, warning) {
+			preview.Warnings = append(preview.Warnings, warning)
+		}
+		if match := processLineRegex.FindStringSubmatch(line); match != nil {
+			addProcess(match[1])
+		}
+		if errorAt < 0 && strings.HasPrefix(line, "ERROR ~ ") {
+			errorAt = i
+		}
+	}
+
+	if errorAt >= 0 {
+		preview.Error = parseError(lines[errorAt:])
+	}
+
+	return preview
+}
+
+// parseError reads the message and location of the error starting at the
+// first line, the message ends at a blank line or the hint to check a file
+func parseError(lines []string) *PreviewError {
+	message := []string{strings.TrimPrefix(lines[0], "ERROR ~ ")}
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "-- Check") {
+			break
+		}
+		message = append(message, line)
+	}
+
+	e := &PreviewError{Message: strings.Join(message, "\n")}
+
+	text := strings.Join(lines, "\n")
+	if match := checkScriptRegex.FindStringSubmatch(text); match != nil {
+		e.File = match[1]
+		e.Line, _ = strconv.Atoi(match[2])
+	}
+	if match := errorFileRegex.FindStringSubmatch(text); match != nil {
+		e.File = match[1]
+	}
+	if match := errorLineColumnRegex.FindStringSubmatch(text); match != nil {
+		e.Line, _ = strconv.Atoi(match[1])
+		e.Column, _ = strconv.Atoi(match[2])
+	}
+
+	return e
+}
@@ -0,0 +1,140 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePreview(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		log       string
+		processes []string
+		warnings  []string
+		err       *PreviewError
+	}{
+		{
+			name: "success",
+			output: "N E X T F L O W  ~  version 24.04.4\n" +
+				"Launching `https://github.com/nf-core/demo` [mock] DSL2 - revision: 04cb2c9 [master]\n" +
+				"WARN: Access to undefined parameter `genome` -- Initialise it to a default value eg. `params.genome = some_value`\n" +
+				"\x1b[2m[-        ] \x1b[0mprocess > NFCORE_DEMO:DEMO:FASTQC -\n" +
+				"[-        ] process > NFCORE_DEMO:DEMO:MULTIQC -\n" +
+				"WARN: Access to undefined parameter `genome` -- Initialise it to a default value eg. `params.genome = some_value`\n",
+			log: "Oct-17 10:00:01.000 [main] DEBUG nextflow.processor.TaskProcessor - Starting process > NFCORE_DEMO:DEMO:SEQTK_TRIM\n" +
+				"Oct-17 10:00:01.010 [main] DEBUG nextflow.processor.TaskProcessor - Starting process > NFCORE_DEMO:DEMO:FASTQC\n",
+			processes: []string{"NFCORE_DEMO:DEMO:SEQTK_TRIM", "NFCORE_DEMO:DEMO:FASTQC", "NFCORE_DEMO:DEMO:MULTIQC"},
+			warnings:  []string{"Access to undefined parameter `genome` -- Initialise it to a default value eg. `params.genome = some_value`"},
+		},
+		{
+			name: "compilation error",
+			output: "N E X T F L O W  ~  version 24.04.4\n" +
+				"ERROR ~ Script compilation error\r\n" +
+				"- file : /root/.nextflow/assets/nf-core/demo/main.nf\n" +
+				"- cause: Unexpected input: '{' @ line 12, column 5.\n" +
+				"   workflow {\n" +
+				"\n" +
+				" -- Check '.nextflow.log' file for details\n",
+			err: &PreviewError{
+				Message: "Script compilation error\n- file : /root/.nextflow/assets/nf-core/demo/main.nf\n- cause: Unexpected input: '{' @ line 12, column 5.\n   workflow {",
+				File:    "/root/.nextflow/assets/nf-core/demo/main.nf",
+				Line:    12,
+				Column:  5,
+			},
+		},
+		{
+			name: "runtime error",
+			output: "N E X T F L O W  ~  version 24.04.4\n" +
+				"ERROR ~ No such variable: reads\n" +
+				"\n" +
+				" -- Check script 'workflows/demo.nf' at line: 41 or see '.nextflow.log' file for more details\n",
+			err: &PreviewError{Message: "No such variable: reads", File: "workflows/demo.nf", Line: 41},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview := parsePreview(tt.output, tt.log)
+
+			processes := tt.processes
+			if processes == nil {
+				processes = []string{}
+			}
+			if !reflect.DeepEqual(preview.Processes, processes) {
+				t.Errorf("processes = %q, want %q", preview.Processes, processes)
+			}
+
+			warnings := tt.warnings
+			if warnings == nil {
+				warnings = []string{}
+			}
+			if !reflect.DeepEqual(preview.Warnings, warnings) {
+				t.Errorf("warnings = %q, want %q", preview.Warnings, warnings)
+			}
+
+			if !reflect.DeepEqual(preview.Error, tt.err) {
+				t.Errorf("error = %+v, want %+v", preview.Error, tt.err)
+			}
+		})
+	}
+}
+
+func TestRunPreview(t *testing.T) {
+	dir := t.TempDir()
+	// stands in for nextflow, logging its arguments and failing unless
+	// given a preview
+	script := `#!/bin/sh
+log=$2
+echo "$@" > "$log"
+echo "Starting process > HELLO" >> "$log"
+case " $* " in
+  *" -preview "*) echo "WARN: preview only"; exit 0 ;;
+esac
+echo "ERROR ~ not a preview"
+exit 1
+`
+	bin := filepath.Join(dir, "nextflow")
+	err := os.WriteFile(bin, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	run := RunConfig{PipelineUrl: "nf-core/demo", Args: []string{"--input", "a.csv"}, Params: map[string]any{"outdir": "out"}}
+
+	preview, err := RunPreview(context.Background(), logger, run, bin, "demo-check", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Err != nil || preview.Error != nil {
+		t.Fatalf("expected the preview to succeed, got %v %+v", preview.Err, preview.Error)
+	}
+	if !reflect.DeepEqual(preview.Processes, []string{"HELLO"}) || !reflect.DeepEqual(preview.Warnings, []string{"preview only"}) {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+	for _, arg := range []string{"run nf-core/demo", "-name demo-check", "-preview", "-params-file"} {
+		if !strings.Contains(preview.Log, arg) {
+			t.Errorf("expected %q in the arguments %q", arg, preview.Log)
+		}
+	}
+
+	if CanPreview(RunConfig{Args: []string{"-main-script", "other.nf"}}) {
+		t.Error("expected -main-script runs not to be previewed")
+	}
+
+	// a failing nextflow is reported in the result
+	preview, err = RunPreview(context.Background(), logger, run, "/bin/false", "demo-check", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Err == nil || preview.Error == nil {
+		t.Errorf("expected a failed preview, got %+v", preview)
+	}
+}
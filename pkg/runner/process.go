@@ -1,71 +1,120 @@
 package runner
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 )
 
-func killProcessByID(pid int) error {
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		return fmt.Errorf("failed to find process with PID %d: %v", pid, err)
-	}
+// time a process gets to exit after SIGTERM before it is killed, and after
+// SIGKILL before stopping it fails
+var (
+	stopTimeout = 15 * time.Second
+	killTimeout = 5 * time.Second
+)
 
-	err = process.Kill()
-	if err != nil {
-		return fmt.Errorf("failed to kill process with PID %d: %v", pid, err)
+// processes started by the worker, mapped to a channel closed once the
+// goroutine that started the process reaped it
+var processes = struct {
+	sync.Mutex
+	exited map[int]chan struct{}
+}{exited: make(map[int]chan struct{})}
+
+// TrackProcess registers a started child process. Only the goroutine that
+// started it waits on it, that goroutine calls the returned func once Wait
+// returned so processes stopped meanwhile keep their exit status.
+func TrackProcess(pid int) func() {
+	done := make(chan struct{})
+
+	processes.Lock()
+	processes.exited[pid] = done
+	processes.Unlock()
+
+	return func() {
+		processes.Lock()
+		if processes.exited[pid] == done {
+			delete(processes.exited, pid)
+		}
+		processes.Unlock()
+		close(done)
 	}
+}
 
-	_, err = process.Wait()
-	if err != nil {
-		return fmt.Errorf("error waiting for process %d to exit: %v", pid, err)
+// waitExited reports whether a process exited within timeout. Tracked
+// processes are waited for through their starter, others are polled.
+func waitExited(pid int, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	processes.Lock()
+	done := processes.exited[pid]
+	processes.Unlock()
+	if done != nil {
+		select {
+		case <-done:
+			return true
+		case <-timer.C:
+			return false
+		}
 	}
 
-	return nil
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for ProcessAlive(pid) {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return !ProcessAlive(pid)
+		}
+	}
+	return true
 }
 
+// GracefullyStopProcessByID sends SIGTERM to a process and SIGKILL when it
+// did not exit in time. The process is never waited on here, see
+// TrackProcess.
 func GracefullyStopProcessByID(pid int) error {
 	process, err := os.FindProcess(pid)
 	if err != nil {
 		return fmt.Errorf("failed to find process with PID %d: %v", pid, err)
 	}
 
-	// Send SIGTERM
 	err = process.Signal(syscall.SIGTERM)
+	if errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("%w: process %d exited", ErrAlreadyFinished, pid)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to send SIGTERM to process %d: %v", pid, err)
 	}
-
-	// Wait for the process to exit (with timeout)
-	done := make(chan error, 1)
-	go func() {
-		_, err := process.Wait()
-		done <- err
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("error waiting for process %d to exit: %v", pid, err)
-		}
-	case <-time.After(15 * time.Second):
-		// If the process doesn't exit within 10 seconds, force kill it
-		return killProcessByID(pid)
+	if waitExited(pid, stopTimeout) {
+		return nil
 	}
 
+	err = process.Kill()
+	if err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill process with PID %d: %v", pid, err)
+	}
+	if !waitExited(pid, killTimeout) {
+		return fmt.Errorf("process %d did not exit after SIGKILL", pid)
+	}
 	return nil
 }
 
-// nextflow has a bug where sometimes cached github repos are corrupted
-// deleting the repositories as a temporary solution
-func RemoveNfAssetsDir() error {
-	homeDir, err := os.UserHomeDir()
+// ProcessAlive reports whether a process with the given PID exists
+func ProcessAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
 	if err != nil {
-		return err
+		return false
 	}
-	path := filepath.Join(homeDir, ".nextflow", "assets")
-	return os.RemoveAll(path)
+
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// nextflow has a bug where sometimes cached github repos are corrupted
+// deleting the repositories of the run as a temporary solution
+func RemoveNfAssetsDir(launchDir string) error {
+	return os.RemoveAll(AssetsDir(launchDir))
 }
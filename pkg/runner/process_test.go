@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startTracked starts a command the way the runners do, the goroutine that
+// started it is the one reaping it
+func startTracked(t *testing.T, name string, args ...string) (*exec.Cmd, <-chan struct{}) {
+	t.Helper()
+
+	cmd := exec.Command(name, args...)
+	err := cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exited := TrackProcess(cmd.Process.Pid)
+	done := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		exited()
+		close(done)
+	}()
+	return cmd, done
+}
+
+func TestGracefullyStopProcessByID(t *testing.T) {
+	cmd, done := startTracked(t, "sleep", "30")
+	pid := cmd.Process.Pid
+
+	if !ProcessAlive(pid) {
+		t.Fatal("expected process to be alive")
+	}
+
+	err := GracefullyStopProcessByID(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	// the starter keeps the exit status of the stopped process
+	ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() || ws.Signal() != syscall.SIGTERM {
+		t.Errorf("process state = %v, want terminated by SIGTERM", cmd.ProcessState)
+	}
+	if ProcessAlive(pid) {
+		t.Error("expected process to be gone")
+	}
+
+	err = GracefullyStopProcessByID(pid)
+	if !errors.Is(err, ErrAlreadyFinished) {
+		t.Errorf("expected ErrAlreadyFinished, got %v", err)
+	}
+}
+
+func TestGracefullyStopProcessByIDKills(t *testing.T) {
+	timeout := stopTimeout
+	stopTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { stopTimeout = timeout })
+
+	cmd, done := startTracked(t, "bash", "-c", `trap "" TERM; exec sleep 30`)
+	// give bash the time to ignore SIGTERM before it execs sleep
+	time.Sleep(100 * time.Millisecond)
+
+	err := GracefullyStopProcessByID(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	ws, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() || ws.Signal() != syscall.SIGKILL {
+		t.Errorf("process state = %v, want killed", cmd.ProcessState)
+	}
+}
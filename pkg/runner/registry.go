@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrUnknownExecutor = errors.New("unknown executor")
+
+// Capabilities describe what the runner of an executor supports
+type Capabilities struct {
+	// CanStop is set when running jobs can be terminated
+	CanStop bool
+	// CanResume is set when runs can be relaunched with nextflow -resume
+	CanResume bool
+	// NeedsMock is set when runs are validated with a local preview first
+	NeedsMock bool
+}
+
+type Registration struct {
+	Executor     string
+	Runner       Runner
+	Capabilities Capabilities
+}
+
+// Registry maps executor names to the runners handling them
+type Registry struct {
+	executors map[string]Registration
+	mutex     sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		executors: make(map[string]Registration),
+	}
+}
+
+// Register makes the runner handle the given executors.
+func (r *Registry) Register(runner Runner, caps Capabilities, executors ...string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, name := range executors {
+		if _, exists := r.executors[name]; exists {
+			return fmt.Errorf("executor %q is already registered", name)
+		}
+	}
+
+	for _, name := range executors {
+		r.executors[name] = Registration{
+			Executor:     name,
+			Runner:       runner,
+			Capabilities: caps,
+		}
+	}
+
+	return nil
+}
+
+func (r *Registry) Lookup(executor string) (Registration, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	reg, exists := r.executors[executor]
+	if !exists {
+		return Registration{}, fmt.Errorf("%w: %q", ErrUnknownExecutor, executor)
+	}
+	return reg, nil
+}
+
+// Registrations returns all registered executors sorted by name
+func (r *Registry) Registrations() []Registration {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	regs := make([]Registration, 0, len(r.executors))
+	for _, reg := range r.executors {
+		regs = append(regs, reg)
+	}
+	sort.Slice(regs, func(i, j int) bool {
+		return regs[i].Executor < regs[j].Executor
+	})
+	return regs
+}
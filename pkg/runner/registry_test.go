@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type stubRunner struct{}
+
+func (stubRunner) Execute(ctx context.Context, run RunConfig, runName string) (string, error) {
+	return "1", nil
+}
+
+func (stubRunner) Stop(s StopConfig) error {
+	return nil
+}
+
+func (stubRunner) BinPath() string {
+	return "stub"
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	err := r.Register(stubRunner{}, Capabilities{CanStop: true}, "awsbatch", "google-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.Register(stubRunner{}, Capabilities{}, "local", "awsbatch")
+	if err == nil {
+		t.Fatal("Register() with a duplicate executor succeeded")
+	}
+	if _, err := r.Lookup("local"); !errors.Is(err, ErrUnknownExecutor) {
+		t.Errorf("failed Register() left %q registered", "local")
+	}
+
+	reg, err := r.Lookup("google-batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Executor != "google-batch" || !reg.Capabilities.CanStop {
+		t.Errorf("Lookup() = %+v", reg)
+	}
+
+	if _, err := r.Lookup("slurm"); !errors.Is(err, ErrUnknownExecutor) {
+		t.Errorf("Lookup(slurm) error = %v, want %v", err, ErrUnknownExecutor)
+	}
+
+	regs := r.Registrations()
+	if len(regs) != 2 || regs[0].Executor != "awsbatch" || regs[1].Executor != "google-batch" {
+		t.Errorf("Registrations() = %+v", regs)
+	}
+}
@@ -2,15 +2,18 @@ package runner
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"log/slog"
 	"nf-shard-orchestrator/graph/model"
-	"nf-shard-orchestrator/pkg/cache"
+	"nf-shard-orchestrator/pkg/retry"
 	logstream "nf-shard-orchestrator/pkg/streamlogs"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	petname "github.com/dustinkirkland/golang-petname"
 )
@@ -19,15 +22,65 @@ func init() {
 	petname.NonDeterministicMode()
 }
 
+// ErrAlreadyFinished is returned by Stop when the job has already ended
+var ErrAlreadyFinished = errors.New("job already finished")
+
+// NotSubmittedError is returned by Execute for failures before the run
+// reached its executor, only these are safe to launch again
+type NotSubmittedError struct {
+	Err error
+}
+
+func (e *NotSubmittedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NotSubmittedError) Unwrap() error {
+	return e.Err
+}
+
+// NotSubmitted marks err as a failure before submission, nil stays nil
+func NotSubmitted(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &NotSubmittedError{Err: err}
+}
+
+// BeforeSubmit narrows a retry classifier to failures of Execute before
+// submission. A failed submission may still have started a job, e.g. when
+// the response of the executor was lost, launching again would start the
+// run twice.
+func BeforeSubmit(retryable retry.Classifier) retry.Classifier {
+	if retryable == nil {
+		retryable = retry.Transient
+	}
+	return func(err error) bool {
+		var notSubmitted *NotSubmittedError
+		return errors.As(err, &notSubmitted) && retryable(err)
+	}
+}
+
 type RunConfig struct {
-	PipelineUrl    string
+	PipelineUrl string
+	// Revision is the branch, tag or commit passed to nextflow as -r,
+	// empty runs the default branch
+	Revision       string
 	ConfigOverride string
 	Args           []string
+	// Params are the pipeline parameters passed with -params-file, keeping
+	// lists, maps and value types that don't survive as CLI arguments
+	Params map[string]any
 }
 
+// ParamsFileName is the name of the params file written next to the
+// config of a run
+const ParamsFileName = "params.json"
+
 type StopConfig struct {
 	ProcessId  string
 	RunnerName string
+	RunName    string
 }
 
 type Runner interface {
@@ -36,8 +89,64 @@ type Runner interface {
 	BinPath() string
 }
 
+// Validator is implemented by runners that check their environment during
+// the mock phase, before a run is launched
+type Validator interface {
+	Validate(ctx context.Context, run RunConfig) error
+}
+
+// Prober is implemented by runners that can tell whether the process of a
+// run still exists, e.g. after stopping it failed
+type Prober interface {
+	Alive(ctx context.Context, processKey string) (bool, error)
+}
+
 func (r RunConfig) CmdArgs() []string {
-	return append([]string{"run", r.PipelineUrl}, r.Args...)
+	args := []string{"run", r.PipelineUrl}
+	if r.Revision != "" {
+		args = append(args, "-r", r.Revision)
+	}
+	return append(args, r.Args...)
+}
+
+// ParamsFile returns the content of the params file, nil when the run has
+// no params
+func (r RunConfig) ParamsFile() ([]byte, error) {
+	if len(r.Params) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.MarshalIndent(r.Params, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal params: %w", err)
+	}
+	return data, nil
+}
+
+// WriteParamsFile writes the params file to dir and passes it with
+// -params-file
+func (r RunConfig) WriteParamsFile(dir string) (RunConfig, error) {
+	data, err := r.ParamsFile()
+	if err != nil || data == nil {
+		return r, err
+	}
+
+	path := filepath.Join(dir, ParamsFileName)
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return r, fmt.Errorf("failed to write params file: %w", err)
+	}
+
+	r.Args = append(slices.Clone(r.Args), "-params-file", path)
+	return r, nil
+}
+
+// SetRevision sets the revision, replacing any -r or -revision option
+// given with the parameters
+func (r RunConfig) SetRevision(revision string) RunConfig {
+	r.Revision = revision
+	r.Args = removeOption(r.Args, "-r", "-revision")
+	return r
 }
 
 func (r RunConfig) Mock() RunConfig {
@@ -49,18 +158,24 @@ func (r RunConfig) Mock() RunConfig {
 	return r
 }
 
-func (r RunConfig) RemoveWorkDir() RunConfig {
-	args := []string{}
+// removeOption drops the given options and their values from args
+func removeOption(args []string, options ...string) []string {
+	kept := []string{}
 
-	for i, arg := range r.Args {
-		if arg == "-work-dir" || arg == "-bucket-dir" {
+	for i := 0; i < len(args); i++ {
+		if slices.Contains(options, args[i]) {
+			// skip the option value too
 			i++
 			continue
 		}
-		args = append(args, arg)
+		kept = append(kept, args[i])
 	}
 
-	r.Args = args
+	return kept
+}
+
+func (r RunConfig) RemoveWorkDir() RunConfig {
+	r.Args = removeOption(r.Args, "-work-dir", "-bucket-dir")
 	return r
 }
 
@@ -82,82 +197,109 @@ func (r RunConfig) AddWorkDirIfNotExists() RunConfig {
 }
 
 func (r RunConfig) SetRunName(runName string) RunConfig {
-	args := []string{}
+	r.Args = append(removeOption(r.Args, "-name"), "-name", runName)
+	return r
+}
 
-	for i, arg := range r.Args {
-		if arg == "-name" {
-			i++
+// removeResume drops -resume and its optional session from args
+func removeResume(args []string) []string {
+	kept := []string{}
+
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-resume" {
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+			}
 			continue
 		}
-		args = append(args, arg)
+		kept = append(kept, args[i])
 	}
 
-	r.Args = append(args, "-name", runName)
-	return r
-
+	return kept
 }
 
-func MockExecute(ctx context.Context, logger *slog.Logger, run RunConfig, nextflowBinPath string, nc *nats.Conn, runName string, logCache *cache.Cache[model.Log]) error {
-	// unable to simulate workflows with `main-script`
-	for _, arg := range run.Args {
-		if arg == "-main-script" {
-			return nil
+// NextflowRunName returns the value of the -name option
+func (r RunConfig) NextflowRunName() string {
+	for i, arg := range r.Args {
+		if arg == "-name" && i+1 < len(r.Args) {
+			return r.Args[i+1]
 		}
 	}
+	return ""
+}
+
+// AttemptName is the nextflow run name of an attempt. Nextflow refuses to
+// reuse run names, so every attempt after the first is named after the run
+// and its attempt number.
+func AttemptName(runName string, attempt int) string {
+	if attempt <= 1 {
+		return runName
+	}
+	return fmt.Sprintf("%s-%d", runName, attempt)
+}
 
-	// name has to be unique for mock
-	run = run.SetRunName(runName + "-mock")
+// NextAttempt relaunches the run as the given attempt, resuming the
+// session or nextflow run name of a previous attempt
+func (r RunConfig) NextAttempt(runName string, attempt int, resume string) RunConfig {
+	r.Args = removeResume(r.Args)
+	if resume != "" {
+		r.Args = append(r.Args, "-resume", resume)
+	}
+	return r.SetRunName(AttemptName(runName, attempt))
+}
 
-	// for mocking work dir is nescessary
-	run = run.AddWorkDirIfNotExists()
+// ShellQuote quotes a word for bash
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
 
-	logger.Info("Running nextflow mock")
-	tempDir, err := os.MkdirTemp("", "runner-")
-	if err != nil {
-		logger.Error("Failed to create temporary directory", "error", err)
-		return err
+func mockLog(message string) model.Log {
+	return model.Log{
+		Message: message,
+		Stream:  model.LogStreamMock,
+		Phase:   model.LogPhaseValidation,
 	}
+}
 
-	run = run.Mock()
+// MockExecute previews a run in its launch directory before it is
+// launched, see RunPreview
+func MockExecute(ctx context.Context, logger *slog.Logger, run RunConfig, nextflowBinPath string, js jetstream.JetStream, runName string, launchDir string) error {
+	// unable to simulate workflows with `main-script`
+	if !CanPreview(run) {
+		return nil
+	}
 
-	configFileName := "injected.config"
-	configFilePath := filepath.Join(tempDir, configFileName)
-	err = os.WriteFile(configFilePath, []byte(run.ConfigOverride), 0644)
+	logger.Info("Running nextflow mock")
+	// name has to be unique for mock, the history of the launch directory
+	// keeps the names of earlier attempts and retries
+	preview, err := RunPreview(ctx, logger, run, nextflowBinPath, runName+"-mock-"+petname.Generate(2, "-"), launchDir)
 	if err != nil {
 		return err
 	}
 
-	args := run.CmdArgs()
-	args = append(args, "-c", configFilePath)
-
-	command := exec.CommandContext(ctx, nextflowBinPath, args...)
-	command.Env = os.Environ()
-	output, err := command.CombinedOutput()
-
-	if err != nil {
-		logger.Info("nextflow mock error", "error", err, "output", string(output))
-		err = logstream.PublishLog(nc, runName, model.Log{Message: err.Error()}, logCache)
-		if err != nil {
-			logger.Error("Failed to publish log", "error", err)
-			return err
+	if preview.Err != nil {
+		logger.Info("nextflow mock error", "error", preview.Err, "output", preview.Output)
+		pubErr := logstream.PublishLog(js, runName, model.Log{
+			Message: preview.Err.Error(),
+			Stream:  model.LogStreamSystem,
+			Level:   model.LogLevelError,
+			Phase:   model.LogPhaseValidation,
+		})
+		if pubErr != nil {
+			logger.Error("Failed to publish log", "error", pubErr)
+			return pubErr
 		}
-		err = logstream.PublishLog(nc, runName, model.Log{Message: string(output)}, logCache)
-		if err != nil {
-			logger.Error("Failed to publish log", "error", err)
-			return err
+		pubErr = logstream.PublishLog(js, runName, mockLog(preview.Output))
+		if pubErr != nil {
+			logger.Error("Failed to publish log", "error", pubErr)
+			return pubErr
 		}
 
-		// open and print .nextflow.log
-		logPath := filepath.Join("", ".nextflow.log")
-		logFile, nfErr := os.ReadFile(logPath)
-		if nfErr != nil {
-			logger.Error("Failed to read .nextflow.log", "error", err)
-		}
-		logger.Info("nextflow log", "log", string(logFile))
-		return fmt.Errorf("%w: %s", err, output)
+		logger.Info("nextflow log", "log", preview.Log)
+		return fmt.Errorf("%w: %s", preview.Err, preview.Output)
 	}
-	logger.Info("nextflow mock succeeded", "output", string(output))
-	err = logstream.PublishLog(nc, runName, model.Log{Message: string(output)}, logCache)
+	logger.Info("nextflow mock succeeded", "output", preview.Output)
+	err = logstream.PublishLog(js, runName, mockLog(preview.Output))
 	if err != nil {
 		logger.Error("Failed to publish log", "error", err)
 		return err
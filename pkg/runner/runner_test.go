@@ -0,0 +1,217 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunConfigArgs(t *testing.T) {
+	run := RunConfig{
+		Args: []string{"--input", "s3://in", "-name", "old", "-work-dir", "/work", "-resume"},
+	}
+
+	got := run.RemoveWorkDir().Args
+	want := []string{"--input", "s3://in", "-name", "old", "-resume"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RemoveWorkDir() = %v, want %v", got, want)
+	}
+
+	got = run.SetRunName("new").Args
+	want = []string{"--input", "s3://in", "-work-dir", "/work", "-resume", "-name", "new"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SetRunName() = %v, want %v", got, want)
+	}
+}
+
+func TestRunConfigRevision(t *testing.T) {
+	run := RunConfig{PipelineUrl: "nf-core/rnaseq", Args: []string{"-r", "dev", "--input", "s3://in"}}
+
+	got := run.CmdArgs()
+	want := []string{"run", "nf-core/rnaseq", "-r", "dev", "--input", "s3://in"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CmdArgs() = %v, want %v", got, want)
+	}
+
+	got = run.SetRevision("3.14.0").CmdArgs()
+	want = []string{"run", "nf-core/rnaseq", "-r", "3.14.0", "--input", "s3://in"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SetRevision() = %v, want %v", got, want)
+	}
+}
+
+func TestWriteParamsFile(t *testing.T) {
+	dir := t.TempDir()
+
+	run, err := RunConfig{Args: []string{"--outdir", "out"}}.WriteParamsFile(dir)
+	if err != nil || !reflect.DeepEqual(run.Args, []string{"--outdir", "out"}) {
+		t.Fatalf("WriteParamsFile() without params = %v, %v", run.Args, err)
+	}
+
+	run, err = RunConfig{
+		Args:   []string{"--outdir", "out"},
+		Params: map[string]any{"input": "samples sheet.csv", "genomes": []any{"GRCh38"}, "max_cpus": 8},
+	}.WriteParamsFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, ParamsFileName)
+	want := []string{"--outdir", "out", "-params-file", path}
+	if !reflect.DeepEqual(run.Args, want) {
+		t.Errorf("args = %v, want %v", run.Args, want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFile := `{
+  "genomes": [
+    "GRCh38"
+  ],
+  "input": "samples sheet.csv",
+  "max_cpus": 8
+}`
+	if string(data) != wantFile {
+		t.Errorf("params file = %s, want %s", data, wantFile)
+	}
+}
+
+func TestNextAttempt(t *testing.T) {
+	run := RunConfig{Args: []string{"-resume", "--input", "s3://in", "-name", "run"}}
+
+	got := run.NextAttempt("run", 2, "run").Args
+	want := []string{"--input", "s3://in", "-resume", "run", "-name", "run-2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NextAttempt() = %v, want %v", got, want)
+	}
+
+	session := "4dc49c1b-5bb4-4ea9-b3e4-8b8f5c8e4d2a"
+	got = run.NextAttempt("run", 2, "run").NextAttempt("run", 3, session).Args
+	want = []string{"--input", "s3://in", "-resume", session, "-name", "run-3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NextAttempt() = %v, want %v", got, want)
+	}
+}
+
+func TestSessionID(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, ".nextflow"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := "2024-05-01 10:00:00\t1m 2s\trun\tERR\t1a2b3c4d5e\t4dc49c1b-5bb4-4ea9-b3e4-8b8f5c8e4d2a\tnextflow run x -name run\n" +
+		"2024-05-01 11:00:00\t-\tother\t-\t1a2b3c4d5e\t0b6a7f1e-0000-4ea9-b3e4-8b8f5c8e4d2a\tnextflow run x -name other\n"
+	err = os.WriteFile(filepath.Join(dir, ".nextflow", "history"), []byte(history), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := SessionID(dir, "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session != "4dc49c1b-5bb4-4ea9-b3e4-8b8f5c8e4d2a" {
+		t.Errorf("unexpected session %q", session)
+	}
+
+	_, err = SessionID(dir, "missing")
+	if err == nil {
+		t.Error("expected error for unknown run")
+	}
+}
+
+func TestReadLogTail(t *testing.T) {
+	dir := t.TempDir()
+	path := LogFile(dir, "run-2")
+	if path != filepath.Join(dir, "nextflow-run-2.log") {
+		t.Errorf("unexpected log file %q", path)
+	}
+
+	err := os.WriteFile(path, []byte("first line\nsecond line\nthird\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		maxBytes int64
+		want     string
+	}{
+		{1024, "first line\nsecond line\nthird\n"},
+		{15, "third\n"},
+		{18, "second line\nthird\n"},
+	} {
+		got, err := ReadLogTail(path, tt.maxBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("ReadLogTail(%d) = %q, want %q", tt.maxBytes, got, tt.want)
+		}
+	}
+
+	_, err = ReadLogTail(LogFile(dir, "missing"), 1024)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected a missing log, got %v", err)
+	}
+}
+
+func TestBeforeSubmit(t *testing.T) {
+	retryable := BeforeSubmit(nil)
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: NotSubmitted(errors.New("float login failed: connection reset by peer")), want: true},
+		{err: fmt.Errorf("launch: %w", NotSubmitted(errors.New("i/o timeout"))), want: true},
+		{err: NotSubmitted(errors.New("invalid pipeline")), want: false},
+		{err: errors.New("float submit failed: exit status 1: 504 gateway timeout"), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("BeforeSubmit(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	if NotSubmitted(nil) != nil {
+		t.Error("expected nil error to stay nil")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	words := []string{
+		"",
+		"plain",
+		`it's`,
+		`'; touch pwned; echo '`,
+		`$(touch pwned) ${HOME} "quoted" \n \`,
+		"`touch pwned`",
+		"line one\ntouch pwned",
+		"  spaces  ",
+		"*",
+	}
+
+	for _, word := range words {
+		dir := t.TempDir()
+		cmd := exec.Command("bash", "-c", "printf '%s' "+ShellQuote(word))
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("ShellQuote(%q): %v: %s", word, err, output)
+		}
+		if string(output) != word {
+			t.Errorf("ShellQuote(%q) printed %q", word, output)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+			t.Errorf("ShellQuote(%q) ran an injected command", word)
+		}
+	}
+}
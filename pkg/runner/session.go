@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var sessionRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// LaunchDirer is implemented by runners that start nextflow in a directory
+// of their own instead of the worker's working directory
+type LaunchDirer interface {
+	LaunchDir(runName string) string
+}
+
+// LaunchDir returns the directory nextflow is started in for a run
+func LaunchDir(r Runner, runName string) string {
+	if l, ok := r.(LaunchDirer); ok {
+		return l.LaunchDir(runName)
+	}
+	return "."
+}
+
+// AssetsDir is where nextflow pulls the pipeline of a run launched in
+// launchDir to, runs don't share their checkouts
+func AssetsDir(launchDir string) string {
+	return filepath.Join(launchDir, ".nextflow", "assets")
+}
+
+// LogFile is the nextflow log of an attempt launched in launchDir, every
+// attempt logs to a file of its own
+func LogFile(launchDir string, nextflowRunName string) string {
+	return filepath.Join(launchDir, "nextflow-"+nextflowRunName+".log")
+}
+
+// Env is the environment of nextflow launched in launchDir
+func Env(launchDir string) []string {
+	return append(os.Environ(), "NXF_ASSETS="+AssetsDir(launchDir))
+}
+
+// ReadLogTail returns the last complete lines of a log within maxBytes
+func ReadLogTail(path string, maxBytes int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	// the byte before the tail tells whether its first line is complete
+	offset := max(info.Size()-maxBytes-1, 0)
+	data := make([]byte, info.Size()-offset)
+	_, err = f.ReadAt(data, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	if offset > 0 {
+		// drop the line cut off at the start
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		} else {
+			data = nil
+		}
+	}
+	return string(data), nil
+}
+
+// SessionID returns the session of a nextflow run from the history kept in
+// its launch directory. History lines are tab separated, the run name is
+// the third and the session the sixth field.
+func SessionID(launchDir string, nextflowRunName string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(launchDir, ".nextflow", "history"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read nextflow history: %w", err)
+	}
+
+	session := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) >= 6 && fields[2] == nextflowRunName {
+			session = fields[5]
+		}
+	}
+
+	if !sessionRegex.MatchString(session) {
+		return "", fmt.Errorf("no session recorded for nextflow run %s", nextflowRunName)
+	}
+	return session, nil
+}
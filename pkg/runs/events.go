@@ -0,0 +1,178 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"nf-shard-orchestrator/graph/model"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const SubjectPrefix = "runs"
+
+// FinishedSubject receives a terminal event from a runner when a run's
+// process exits.
+func FinishedSubject(runName string) string {
+	return fmt.Sprintf("%s.%s.finished", SubjectPrefix, runName)
+}
+
+// StatusSubject receives the run status after every state change.
+func StatusSubject(runName string) string {
+	return fmt.Sprintf("%s.%s.status", SubjectPrefix, runName)
+}
+
+func PublishFinished(nc *nats.Conn, status model.RunStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run status: %w", err)
+	}
+
+	err = nc.Publish(FinishedSubject(status.RunName), data)
+	if err != nil {
+		return fmt.Errorf("failed to publish run status: %w", err)
+	}
+
+	return nil
+}
+
+// Status returns the status view of a run record.
+func Status(run *model.Run) *model.RunStatus {
+	stderrTail := run.StderrTail
+	if stderrTail == nil {
+		stderrTail = []string{}
+	}
+
+	status := &model.RunStatus{
+		RunName:         run.RunName,
+		State:           run.State,
+		ExitCode:        run.ExitCode,
+		Signal:          run.Signal,
+		DurationSeconds: run.DurationSeconds,
+		StderrTail:      stderrTail,
+		Error:           run.Error,
+		FinishedAt:      run.FinishedAt,
+	}
+	if run.ProcessKey != "" {
+		status.ProcessKey = &run.ProcessKey
+	}
+	return status
+}
+
+// staleProcess reports whether a finished event is from another process than
+// the current attempt of a run. The current process may finish before it is
+// recorded, then the event is only stale for a process of an earlier attempt.
+func staleProcess(run *model.Run, status model.RunStatus) bool {
+	if status.ProcessKey == nil || *status.ProcessKey == "" {
+		return false
+	}
+	if run.ProcessKey != "" {
+		return run.ProcessKey != *status.ProcessKey
+	}
+	for _, attempt := range run.Attempts {
+		if attempt.ProcessKey == *status.ProcessKey {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) publishStatus(run *model.Run) {
+	data, err := json.Marshal(Status(run))
+	if err != nil {
+		s.logger.Error("failed to marshal run status", "error", err)
+		return
+	}
+
+	err = s.nc.Publish(StatusSubject(run.RunName), data)
+	if err != nil {
+		s.logger.Error("failed to publish run status", "run_name", run.RunName, "error", err)
+	}
+}
+
+// Finish records the exit status reported by a runner, with the error of
+// runs that ended without an exit status. The process exit is
+// authoritative for runs that are still active, even if the launch has not
+// been recorded as RUNNING yet, unless the run is being cancelled. Runs that
+// already reached a terminal state, e.g. cancelled ones, keep their state and
+// only gain the exit details. Events of another process than the current
+// attempt's are rejected with ErrStaleEvent.
+func (s *Store) Finish(ctx context.Context, status model.RunStatus) (*model.Run, error) {
+	if !IsTerminal(status.State) {
+		return nil, fmt.Errorf("%w: %s is not a terminal state", ErrInvalidTransition, status.State)
+	}
+
+	run, err := s.Update(ctx, status.RunName, func(run *model.Run) error {
+		// a queued run has no process, the event is from a preempted attempt
+		if run.State == model.RunStateQueued {
+			return fmt.Errorf("%w: %s is queued", ErrStaleEvent, run.RunName)
+		}
+		if staleProcess(run, status) {
+			return fmt.Errorf("%w: %s is not the process of %s", ErrStaleEvent, *status.ProcessKey, run.RunName)
+		}
+
+		if !IsTerminal(run.State) {
+			run.State = status.State
+			if run.CancelRequested {
+				run.State = model.RunStateCancelled
+			}
+			run.FinishedAt = status.FinishedAt
+		}
+
+		run.ExitCode = status.ExitCode
+		run.Signal = status.Signal
+		run.DurationSeconds = status.DurationSeconds
+		run.StderrTail = status.StderrTail
+		if status.Error != nil {
+			run.Error = status.Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishStatus(run)
+	return run, nil
+}
+
+// Watch applies finished events published by runners until the
+// subscription is drained.
+func (s *Store) Watch() (*nats.Subscription, error) {
+	return s.nc.Subscribe(FinishedSubject("*"), func(msg *nats.Msg) {
+		var status model.RunStatus
+		if err := json.Unmarshal(msg.Data, &status); err != nil {
+			s.logger.Error("failed to unmarshal run status", "error", err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := s.Finish(ctx, status)
+		if errors.Is(err, ErrStaleEvent) {
+			s.logger.Info("ignoring finished event", "run_name", status.RunName, "error", err)
+			return
+		}
+		if err != nil {
+			s.logger.Error("failed to record finished run", "run_name", status.RunName, "error", err)
+		}
+	})
+}
+
+// SubscribeStatus calls fn with the status of every run after each of its
+// state changes.
+func SubscribeStatus(nc *nats.Conn, logger *slog.Logger, fn func(status model.RunStatus)) (*nats.Subscription, error) {
+	return nc.Subscribe(StatusSubject("*"), func(msg *nats.Msg) {
+		var status model.RunStatus
+		if err := json.Unmarshal(msg.Data, &status); err != nil {
+			logger.Error("failed to unmarshal run status", "error", err)
+			return
+		}
+
+		fn(status)
+	})
+}
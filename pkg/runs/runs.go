@@ -0,0 +1,486 @@
+package runs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"nf-shard-orchestrator/graph/model"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	BucketName = "RUNS"
+
+	defaultPageLimit = 50
+)
+
+var (
+	ErrNotFound          = errors.New("run not found")
+	ErrExists            = errors.New("run already exists")
+	ErrInvalidName       = errors.New("invalid run name")
+	ErrInvalidTransition = errors.New("invalid run state transition")
+	// ErrStaleEvent is returned by Finish for events of a previous attempt
+	ErrStaleEvent = errors.New("stale run event")
+)
+
+// run names are used as KV keys and NATS subject tokens
+var nameRegex = regexp.MustCompile(`^[-_a-zA-Z0-9]+$`)
+
+func ValidName(runName string) bool {
+	return nameRegex.MatchString(runName)
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// Store persists run records in a JetStream key-value bucket so they
+// survive worker restarts.
+type Store struct {
+	kv     jetstream.KeyValue
+	nc     *nats.Conn
+	logger *slog.Logger
+}
+
+func NewStore(ctx context.Context, nc *nats.Conn, js jetstream.JetStream, logger *slog.Logger) (*Store, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      BucketName,
+		Description: "nf-shard run registry",
+		Storage:     jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create run bucket: %w", err)
+	}
+
+	return &Store{kv: kv, nc: nc, logger: logger}, nil
+}
+
+// Create records a new run in the PENDING state.
+func (s *Store) Create(ctx context.Context, run model.Run) (*model.Run, error) {
+	if !ValidName(run.RunName) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidName, run.RunName)
+	}
+
+	ts := now()
+	run.State = model.RunStatePending
+	run.Attempt = 1
+	run.CreatedAt = ts
+	run.UpdatedAt = ts
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal run: %w", err)
+	}
+
+	_, err = s.kv.Create(ctx, run.RunName, data)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return nil, fmt.Errorf("%w: %s", ErrExists, run.RunName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store run: %w", err)
+	}
+
+	return &run, nil
+}
+
+func (s *Store) Get(ctx context.Context, runName string) (*model.Run, error) {
+	run, _, err := s.get(ctx, runName)
+	return run, err
+}
+
+func (s *Store) get(ctx context.Context, runName string) (*model.Run, uint64, error) {
+	if !ValidName(runName) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, runName)
+	}
+
+	entry, err := s.kv.Get(ctx, runName)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, runName)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var run model.Run
+	if err := json.Unmarshal(entry.Value(), &run); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal run %s: %w", runName, err)
+	}
+
+	return &run, entry.Revision(), nil
+}
+
+// Update applies fn to the stored run. Concurrent writers are detected
+// through the entry revision and the update is retried.
+func (s *Store) Update(ctx context.Context, runName string, fn func(run *model.Run) error) (*model.Run, error) {
+	for {
+		run, rev, err := s.get(ctx, runName)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fn(run); err != nil {
+			return nil, err
+		}
+		run.UpdatedAt = now()
+
+		data, err := json.Marshal(run)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal run: %w", err)
+		}
+
+		_, err = s.kv.Update(ctx, runName, data, rev)
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			// revision changed underneath us
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to store run: %w", err)
+		}
+
+		return run, nil
+	}
+}
+
+// Transition moves the run to the given state, applying fn to the record
+// in the same write. fn may be nil.
+func (s *Store) Transition(ctx context.Context, runName string, to model.RunState, fn func(run *model.Run)) (*model.Run, error) {
+	run, err := s.Update(ctx, runName, func(run *model.Run) error {
+		if !CanTransition(run.State, to) {
+			return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, run.State, to)
+		}
+
+		ts := now()
+		run.State = to
+		if to == model.RunStateRunning {
+			run.StartedAt = &ts
+		}
+		if IsTerminal(to) {
+			run.FinishedAt = &ts
+		}
+
+		if fn != nil {
+			fn(run)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishStatus(run)
+	return run, nil
+}
+
+// Queue moves a pending run to QUEUED. A run that already left PENDING,
+// e.g. because the queue admitted and launched it meanwhile, is left as it
+// is and ErrInvalidTransition returned.
+func (s *Store) Queue(ctx context.Context, runName string) (*model.Run, error) {
+	run, err := s.Update(ctx, runName, func(run *model.Run) error {
+		if run.State != model.RunStatePending {
+			return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, run.State, model.RunStateQueued)
+		}
+		run.State = model.RunStateQueued
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishStatus(run)
+	return run, nil
+}
+
+// Start records the process key of a launched run and moves it to RUNNING.
+// A run may already have finished by the time its launch is recorded, in
+// which case only the process key is stored.
+func (s *Store) Start(ctx context.Context, runName string, processKey string) (*model.Run, error) {
+	run, err := s.Update(ctx, runName, func(run *model.Run) error {
+		run.ProcessKey = processKey
+		if IsTerminal(run.State) {
+			return nil
+		}
+		if !CanTransition(run.State, model.RunStateRunning) {
+			return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, run.State, model.RunStateRunning)
+		}
+
+		ts := now()
+		run.State = model.RunStateRunning
+		run.StartedAt = &ts
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishStatus(run)
+	return run, nil
+}
+
+// NewAttempt archives the current attempt of a run and resets it for the
+// next one. Failed and cancelled runs move back to PENDING, preempted runs
+// stay QUEUED. Session is the nextflow session of the archived attempt and
+// cause, if set, is recorded as its error.
+func (s *Store) NewAttempt(ctx context.Context, runName string, sessionID string, cause error) (*model.Run, error) {
+	run, err := s.Update(ctx, runName, func(run *model.Run) error {
+		state := run.State
+		next := model.RunStatePending
+
+		switch {
+		case run.State == model.RunStateFailed || run.State == model.RunStateCancelled:
+		case run.State == model.RunStateQueued && run.ProcessKey != "":
+			state = model.RunStateCancelled
+			next = model.RunStateQueued
+		default:
+			return fmt.Errorf("%w: cannot start a new attempt of a %s run", ErrInvalidTransition, run.State)
+		}
+
+		archiveAttempt(run, state, sessionID, cause)
+		run.State = next
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishStatus(run)
+	return run, nil
+}
+
+// archiveAttempt appends the current attempt to the run's attempts and
+// clears the fields describing it
+func archiveAttempt(run *model.Run, state model.RunState, sessionID string, cause error) {
+	attempt := &model.RunAttempt{
+		Attempt:     max(run.Attempt, 1),
+		ProcessKey:  run.ProcessKey,
+		State:       state,
+		ExitCode:    run.ExitCode,
+		Signal:      run.Signal,
+		Error:       run.Error,
+		StartedAt:   run.StartedAt,
+		FinishedAt:  run.FinishedAt,
+		NextflowLog: run.NextflowLog,
+	}
+	if sessionID != "" {
+		attempt.SessionID = &sessionID
+	}
+	if cause != nil {
+		msg := cause.Error()
+		attempt.Error = &msg
+	}
+
+	run.Attempts = append(run.Attempts, attempt)
+	run.Attempt = attempt.Attempt + 1
+	run.LaunchAttempts = nil
+	run.CancelRequested = false
+	run.ProcessKey = ""
+	run.ExitCode = nil
+	run.Signal = nil
+	run.DurationSeconds = nil
+	run.StderrTail = nil
+	run.NextflowLog = nil
+	run.Error = nil
+	run.StartedAt = nil
+	run.FinishedAt = nil
+}
+
+// AddLaunchAttempt records an attempt to validate or launch the current
+// attempt of a run
+func (s *Store) AddLaunchAttempt(ctx context.Context, runName string, attempt model.LaunchAttempt) error {
+	_, err := s.Update(ctx, runName, func(run *model.Run) error {
+		if attempt.Timestamp == "" {
+			attempt.Timestamp = now()
+		}
+		run.LaunchAttempts = append(run.LaunchAttempts, &attempt)
+		return nil
+	})
+	return err
+}
+
+// AttachNextflowLog records the nextflow log of the current attempt of a run
+func (s *Store) AttachNextflowLog(ctx context.Context, runName string, log string) error {
+	_, err := s.Update(ctx, runName, func(run *model.Run) error {
+		run.NextflowLog = &log
+		return nil
+	})
+	return err
+}
+
+// RequestCancel records that a run is cancelled before its process is
+// stopped, the finished event of the stopped process may arrive before the
+// run is moved to CANCELLED and Finish then records it as cancelled.
+// Withdrawing the request, e.g. because stopping failed, keeps the state.
+func (s *Store) RequestCancel(ctx context.Context, runName string, requested bool) (*model.Run, error) {
+	return s.Update(ctx, runName, func(run *model.Run) error {
+		if requested && IsTerminal(run.State) {
+			return fmt.Errorf("%w: run %s is already %s", ErrInvalidTransition, run.RunName, run.State)
+		}
+		run.CancelRequested = requested
+		return nil
+	})
+}
+
+// Fail moves the run to FAILED and records the cause.
+func (s *Store) Fail(ctx context.Context, runName string, cause error) (*model.Run, error) {
+	return s.Transition(ctx, runName, model.RunStateFailed, func(run *model.Run) {
+		msg := cause.Error()
+		run.Error = &msg
+	})
+}
+
+func (s *Store) all(ctx context.Context) ([]*model.Run, error) {
+	keys, err := s.kv.Keys(ctx)
+	if errors.Is(err, jetstream.ErrNoKeysFound) {
+		return []*model.Run{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]*model.Run, 0, len(keys))
+	for _, key := range keys {
+		run, err := s.Get(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			// deleted between listing and reading
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+func matches(run *model.Run, filter *model.RunFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.State != nil && run.State != *filter.State {
+		return false
+	}
+	if filter.Executor != nil && run.Executor != *filter.Executor {
+		return false
+	}
+	if filter.PipelineURL != nil && run.PipelineURL != *filter.PipelineURL {
+		return false
+	}
+	return true
+}
+
+// List returns runs matching the filter, newest first.
+func (s *Store) List(ctx context.Context, filter *model.RunFilter, page *model.PageInput) (*model.RunPage, error) {
+	all, err := s.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*model.Run, 0, len(all))
+	for _, run := range all {
+		if matches(run, filter) {
+			items = append(items, run)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].CreatedAt == items[j].CreatedAt {
+			return items[i].RunName < items[j].RunName
+		}
+		return items[i].CreatedAt > items[j].CreatedAt
+	})
+
+	total := len(items)
+	offset, limit := 0, defaultPageLimit
+	if page != nil {
+		if page.Offset != nil && *page.Offset > 0 {
+			offset = *page.Offset
+		}
+		if page.Limit != nil && *page.Limit > 0 {
+			limit = *page.Limit
+		}
+	}
+
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return &model.RunPage{
+		Items: items[offset:end],
+		Total: total,
+	}, nil
+}
+
+// FindByProcessKey returns the most recent run started with the given
+// executor and process key.
+func (s *Store) FindByProcessKey(ctx context.Context, executor string, processKey string) (*model.Run, error) {
+	all, err := s.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *model.Run
+	for _, run := range all {
+		if run.Executor != executor || run.ProcessKey != processKey {
+			continue
+		}
+		if found == nil || run.CreatedAt > found.CreatedAt {
+			found = run
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: process %s", ErrNotFound, processKey)
+	}
+	return found, nil
+}
+
+// Active returns all runs that have not reached a terminal state.
+func (s *Store) Active(ctx context.Context) ([]*model.Run, error) {
+	all, err := s.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]*model.Run, 0)
+	for _, run := range all {
+		if !IsTerminal(run.State) {
+			active = append(active, run)
+		}
+	}
+	return active, nil
+}
+
+// Reconcile fails every non-terminal run for which alive reports false.
+// It is meant to be called on startup, when runs launched by a previous
+// worker may have been lost.
+func (s *Store) Reconcile(ctx context.Context, alive func(run model.Run) bool) error {
+	all, err := s.all(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range all {
+		if IsTerminal(run.State) || alive(*run) {
+			continue
+		}
+
+		s.logger.Info("marking orphaned run as failed", "run_name", run.RunName, "state", run.State)
+		_, err = s.Fail(ctx, run.RunName, errors.New("orphaned by worker restart"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
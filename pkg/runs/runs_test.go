@@ -0,0 +1,410 @@
+package runs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/natstest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	nc, js := natstest.Start(t)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := NewStore(context.Background(), nc, js, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to model.RunState
+		want     bool
+	}{
+		{model.RunStatePending, model.RunStateValidating, true},
+		{model.RunStateValidating, model.RunStateRunning, true},
+		{model.RunStateRunning, model.RunStateSucceeded, true},
+		{model.RunStateRunning, model.RunStateCancelled, true},
+		{model.RunStateRunning, model.RunStatePending, false},
+		{model.RunStateSucceeded, model.RunStateFailed, false},
+		{model.RunStateCancelled, model.RunStateRunning, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestStoreLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	_, err := store.Create(ctx, model.Run{RunName: "happy-run", Executor: "awsbatch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Create(ctx, model.Run{RunName: "happy-run"})
+	if !errors.Is(err, ErrExists) {
+		t.Fatalf("duplicate Create() error = %v, want %v", err, ErrExists)
+	}
+
+	_, err = store.Create(ctx, model.Run{RunName: "bad name"})
+	if !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("Create() error = %v, want %v", err, ErrInvalidName)
+	}
+
+	_, err = store.Start(ctx, "happy-run", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := store.FindByProcessKey(ctx, "awsbatch", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateRunning || run.StartedAt == nil {
+		t.Errorf("run = %+v, want RUNNING with start time", run)
+	}
+
+	_, err = store.Transition(ctx, "happy-run", model.RunStateSucceeded, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Transition(ctx, "happy-run", model.RunStateFailed, nil)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Transition() error = %v, want %v", err, ErrInvalidTransition)
+	}
+
+	_, err = store.Get(ctx, "missing-run")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestStoreQueue(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	for _, runName := range []string{"waiting-run", "admitted-run"} {
+		_, err := store.Create(ctx, model.Run{RunName: runName, Executor: "local"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run, err := store.Queue(ctx, "waiting-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateQueued {
+		t.Errorf("state = %s, want %s", run.State, model.RunStateQueued)
+	}
+
+	// the queue admitted the run before it was recorded as queued
+	_, err = store.Transition(ctx, "admitted-run", model.RunStateValidating, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Queue(ctx, "admitted-run")
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Queue() error = %v, want %v", err, ErrInvalidTransition)
+	}
+	run, err = store.Get(ctx, "admitted-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateValidating {
+		t.Errorf("state = %s, want %s", run.State, model.RunStateValidating)
+	}
+}
+
+func TestStoreFinish(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	for _, name := range []string{"done-run", "cancelled-run", "cancelling-run", "lost-run"} {
+		_, err := store.Create(ctx, model.Run{RunName: name, Executor: "local"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = store.Start(ctx, name, "42")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sub, err := store.nc.SubscribeSync(StatusSubject("done-run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Finish(ctx, model.RunStatus{RunName: "done-run", State: model.RunStateRunning})
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("Finish() with RUNNING error = %v, want %v", err, ErrInvalidTransition)
+	}
+
+	exitCode := 0
+	finishedAt := now()
+	run, err := store.Finish(ctx, model.RunStatus{
+		RunName:    "done-run",
+		State:      model.RunStateSucceeded,
+		ExitCode:   &exitCode,
+		StderrTail: []string{"done"},
+		FinishedAt: &finishedAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateSucceeded || *run.ExitCode != 0 || *run.FinishedAt != finishedAt || run.StderrTail[0] != "done" {
+		t.Errorf("run = %+v, want SUCCEEDED with exit details", run)
+	}
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(msg.Data), `"state":"SUCCEEDED"`) {
+		t.Errorf("published status = %s", msg.Data)
+	}
+
+	// a cancelled run stays cancelled and gains the exit details
+	_, err = store.Transition(ctx, "cancelled-run", model.RunStateCancelled, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exitCode = 143
+	run, err = store.Finish(ctx, model.RunStatus{RunName: "cancelled-run", State: model.RunStateFailed, ExitCode: &exitCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateCancelled || *run.ExitCode != 143 {
+		t.Errorf("run = %+v, want CANCELLED with exit code", run)
+	}
+
+	// the finished event of a stopped run may arrive before it is cancelled
+	_, err = store.RequestCancel(ctx, "cancelling-run", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err = store.Finish(ctx, model.RunStatus{RunName: "cancelling-run", State: model.RunStateFailed, ExitCode: &exitCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateCancelled || *run.ExitCode != 143 {
+		t.Errorf("run = %+v, want CANCELLED with exit code", run)
+	}
+	_, err = store.RequestCancel(ctx, "cancelling-run", true)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("RequestCancel() of cancelled run error = %v, want %v", err, ErrInvalidTransition)
+	}
+
+	cause := "Stopped following float job 42"
+	run, err = store.Finish(ctx, model.RunStatus{RunName: "lost-run", State: model.RunStateFailed, Error: &cause})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateFailed || run.Error == nil || *run.Error != cause || *Status(run).Error != cause {
+		t.Errorf("run = %+v, want FAILED with error", run)
+	}
+}
+
+func TestStoreList(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	for _, name := range []string{"run-a", "run-b", "run-c"} {
+		_, err := store.Create(ctx, model.Run{RunName: name, Executor: "float"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := store.Fail(ctx, "run-b", errors.New("boom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := model.RunStateFailed
+	page, err := store.List(ctx, &model.RunFilter{State: &failed}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Items[0].RunName != "run-b" || *page.Items[0].Error != "boom" {
+		t.Errorf("List(FAILED) = %+v", page)
+	}
+
+	offset, limit := 1, 1
+	page, err = store.List(ctx, nil, &model.PageInput{Offset: &offset, Limit: &limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || len(page.Items) != 1 {
+		t.Errorf("List(page) total = %d, items = %d, want 3, 1", page.Total, len(page.Items))
+	}
+
+	err = store.Reconcile(ctx, func(run model.Run) bool { return run.RunName == "run-a" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := store.Get(ctx, "run-c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateFailed {
+		t.Errorf("reconciled run state = %s, want FAILED", run.State)
+	}
+}
+
+func TestStoreNewAttempt(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	_, err := store.Create(ctx, model.Run{RunName: "flaky-run", Executor: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.NewAttempt(ctx, "flaky-run", "", nil)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("NewAttempt() of pending run error = %v, want %v", err, ErrInvalidTransition)
+	}
+
+	_, err = store.Start(ctx, "flaky-run", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exitCode := 1
+	_, err = store.Finish(ctx, model.RunStatus{RunName: "flaky-run", State: model.RunStateFailed, ExitCode: &exitCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.AttachNextflowLog(ctx, "flaky-run", "ERROR ~ failed\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := store.NewAttempt(ctx, "flaky-run", "4dc49c1b-5bb4-4ea9-b3e4-8b8f5c8e4d2a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStatePending || run.Attempt != 2 || run.ProcessKey != "" || run.ExitCode != nil || run.NextflowLog != nil {
+		t.Errorf("run = %+v, want PENDING second attempt", run)
+	}
+	if len(run.Attempts) != 1 {
+		t.Fatalf("attempts = %d, want 1", len(run.Attempts))
+	}
+	previous := run.Attempts[0]
+	if previous.Attempt != 1 || previous.ProcessKey != "42" || previous.State != model.RunStateFailed ||
+		*previous.ExitCode != 1 || *previous.SessionID != "4dc49c1b-5bb4-4ea9-b3e4-8b8f5c8e4d2a" ||
+		previous.NextflowLog == nil || *previous.NextflowLog != "ERROR ~ failed\n" {
+		t.Errorf("previous attempt = %+v", previous)
+	}
+
+	// events of the archived attempt don't touch a preempted run
+	_, err = store.Start(ctx, "flaky-run", "43")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Transition(ctx, "flaky-run", model.RunStateQueued, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Finish(ctx, model.RunStatus{RunName: "flaky-run", State: model.RunStateFailed})
+	if !errors.Is(err, ErrStaleEvent) {
+		t.Fatalf("Finish() of queued run error = %v, want %v", err, ErrStaleEvent)
+	}
+
+	run, err = store.NewAttempt(ctx, "flaky-run", "", errors.New("preempted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateQueued || run.Attempt != 3 || *run.Attempts[1].Error != "preempted" {
+		t.Errorf("run = %+v, want QUEUED third attempt", run)
+	}
+
+	// a late event of the preempted process doesn't finish the next attempt,
+	// neither before nor after its process is recorded
+	_, err = store.Transition(ctx, "flaky-run", model.RunStateValidating, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := "43"
+	for _, processKey := range []string{"", "44"} {
+		if processKey != "" {
+			_, err = store.Start(ctx, "flaky-run", processKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		_, err = store.Finish(ctx, model.RunStatus{RunName: "flaky-run", State: model.RunStateFailed, ProcessKey: &stale})
+		if !errors.Is(err, ErrStaleEvent) {
+			t.Fatalf("Finish() of process %s error = %v, want %v", stale, err, ErrStaleEvent)
+		}
+	}
+	current := "44"
+	run, err = store.Finish(ctx, model.RunStatus{RunName: "flaky-run", State: model.RunStateSucceeded, ProcessKey: &current})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.State != model.RunStateSucceeded || *Status(run).ProcessKey != "44" {
+		t.Errorf("run = %+v, want SUCCEEDED", run)
+	}
+}
+
+func TestStoreAddLaunchAttempt(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	_, err := store.Create(ctx, model.Run{RunName: "retried-run", Executor: "float"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := "float login failed"
+	for _, attempt := range []model.LaunchAttempt{
+		{Attempt: 1, Phase: model.LogPhaseRun, Error: &msg, Retried: true},
+		{Attempt: 2, Phase: model.LogPhaseRun},
+	} {
+		err = store.AddLaunchAttempt(ctx, "retried-run", attempt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run, err := store.Get(ctx, "retried-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.LaunchAttempts) != 2 || *run.LaunchAttempts[0].Error != msg || run.LaunchAttempts[1].Error != nil {
+		t.Fatalf("launch attempts = %+v", run.LaunchAttempts)
+	}
+	if run.LaunchAttempts[0].Timestamp == "" {
+		t.Error("expected launch attempt timestamp to be set")
+	}
+
+	// launch attempts belong to the run attempt they launched
+	_, err = store.Fail(ctx, "retried-run", errors.New(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err = store.NewAttempt(ctx, "retried-run", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.LaunchAttempts) != 0 {
+		t.Errorf("launch attempts of new attempt = %+v, want none", run.LaunchAttempts)
+	}
+}
@@ -0,0 +1,49 @@
+package runs
+
+import "nf-shard-orchestrator/graph/model"
+
+// transitions lists the states a run may move to from each non-terminal state.
+var transitions = map[model.RunState][]model.RunState{
+	model.RunStatePending: {
+		model.RunStateQueued,
+		model.RunStateValidating,
+		model.RunStateRunning,
+		model.RunStateFailed,
+		model.RunStateCancelled,
+	},
+	model.RunStateQueued: {
+		model.RunStateValidating,
+		model.RunStateRunning,
+		model.RunStateFailed,
+		model.RunStateCancelled,
+	},
+	model.RunStateValidating: {
+		model.RunStateRunning,
+		model.RunStateFailed,
+		model.RunStateCancelled,
+	},
+	model.RunStateRunning: {
+		// preempted runs wait for a slot to resume
+		model.RunStateQueued,
+		model.RunStateSucceeded,
+		model.RunStateFailed,
+		model.RunStateCancelled,
+	},
+}
+
+func CanTransition(from, to model.RunState) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+func IsTerminal(state model.RunState) bool {
+	switch state {
+	case model.RunStateSucceeded, model.RunStateFailed, model.RunStateCancelled:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,338 @@
+package schedules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/runs"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/robfig/cron/v3"
+)
+
+// run names of a schedule are its prefix and the firing time in UTC
+const runNameLayout = "20060102-150405"
+
+// maximum time a firing may take to launch its run
+const fireTimeout = 30 * time.Minute
+
+// RunName is the name of the run fired by a schedule at the given time
+func RunName(prefix string, at time.Time) string {
+	return prefix + "-" + at.UTC().Format(runNameLayout)
+}
+
+// Fire launches a run from the schedule's template under the given name
+type Fire func(ctx context.Context, schedule model.Schedule, runName string) error
+
+type Config struct {
+	Logger   *slog.Logger
+	Nc       *nats.Conn
+	Store    *Store
+	RunStore *runs.Store
+	Fire     Fire
+}
+
+// Scheduler fires the runs of the stored schedules. A firing while the
+// previous run of a schedule is active is skipped or, with the QUEUE overlap
+// policy, deferred until that run ends.
+type Scheduler struct {
+	config Config
+	logger *slog.Logger
+	store  *Store
+	cron   *cron.Cron
+	sub    *nats.Subscription
+
+	mu      sync.Mutex
+	entries map[string]cron.EntryID
+	// schedules whose run is being launched
+	firing map[string]bool
+}
+
+func NewScheduler(c Config) *Scheduler {
+	return &Scheduler{
+		config:  c,
+		logger:  c.Logger,
+		store:   c.Store,
+		cron:    cron.New(cron.WithLocation(time.UTC)),
+		entries: make(map[string]cron.EntryID),
+		firing:  make(map[string]bool),
+	}
+}
+
+// Start schedules the stored schedules and fires those with a firing
+// deferred before a restart whose previous run has ended since.
+func (s *Scheduler) Start(ctx context.Context) error {
+	schedules, err := s.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range schedules {
+		err := s.add(*schedule)
+		if err != nil {
+			s.logger.Error("invalid schedule", "schedule", schedule.Name, "error", err)
+		}
+	}
+
+	s.sub, err = runs.SubscribeStatus(s.config.Nc, s.logger, func(status model.RunStatus) {
+		if runs.IsTerminal(status.State) {
+			s.runFinished(status.RunName)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch runs: %w", err)
+	}
+
+	s.cron.Start()
+
+	for _, schedule := range schedules {
+		if schedule.PendingFire && !schedule.Paused {
+			go s.fire(schedule.Name)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) Stop() {
+	if s.sub != nil {
+		s.sub.Unsubscribe()
+	}
+	<-s.cron.Stop().Done()
+}
+
+func (s *Scheduler) add(schedule model.Schedule) error {
+	name := schedule.Name
+	id, err := s.cron.AddFunc(schedule.Cron, func() { s.fire(name) })
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", schedule.Cron, err)
+	}
+
+	s.mu.Lock()
+	s.entries[name] = id
+	s.mu.Unlock()
+	return nil
+}
+
+// Create validates and stores a schedule and starts firing it
+func (s *Scheduler) Create(ctx context.Context, schedule model.Schedule) (*model.Schedule, error) {
+	if !runs.ValidName(schedule.Name) {
+		return nil, fmt.Errorf("%w: %q", runs.ErrInvalidName, schedule.Name)
+	}
+	if schedule.RunNamePrefix == "" {
+		schedule.RunNamePrefix = schedule.Name
+	}
+	if !runs.ValidName(schedule.RunNamePrefix) {
+		return nil, fmt.Errorf("%w: %q", runs.ErrInvalidName, schedule.RunNamePrefix)
+	}
+	if _, err := cron.ParseStandard(schedule.Cron); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", schedule.Cron, err)
+	}
+	if schedule.Overlap == "" {
+		schedule.Overlap = model.ScheduleOverlapSkip
+	}
+
+	created, err := s.store.Create(ctx, schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.add(*created)
+	if err != nil {
+		// a stored schedule would be scheduled on the next start
+		if deleteErr := s.store.Delete(ctx, created.Name); deleteErr != nil {
+			s.logger.Error("failed to delete unscheduled schedule", "schedule", created.Name, "error", deleteErr)
+		}
+		return nil, err
+	}
+
+	s.logger.Info("schedule created", "schedule", created.Name, "cron", created.Cron)
+	return created, nil
+}
+
+// SetPaused pauses or resumes the firings of a schedule. Resuming drops a
+// firing deferred while the schedule was paused.
+func (s *Scheduler) SetPaused(ctx context.Context, name string, paused bool) (*model.Schedule, error) {
+	return s.store.Update(ctx, name, func(schedule *model.Schedule) error {
+		schedule.Paused = paused
+		schedule.PendingFire = false
+		return nil
+	})
+}
+
+func (s *Scheduler) Delete(ctx context.Context, name string) error {
+	err := s.store.Delete(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.entries[name]; ok {
+		s.cron.Remove(id)
+		delete(s.entries, name)
+	}
+	return nil
+}
+
+// Next returns the next firing time of a schedule
+func (s *Scheduler) Next(name string) (time.Time, bool) {
+	s.mu.Lock()
+	id, ok := s.entries[name]
+	s.mu.Unlock()
+	if !ok {
+		return time.Time{}, false
+	}
+
+	next := s.cron.Entry(id).Next
+	return next, !next.IsZero()
+}
+
+// active reports whether the run is still to end, must be called with the
+// lock held
+func (s *Scheduler) active(ctx context.Context, schedule *model.Schedule) (bool, error) {
+	if s.firing[schedule.Name] {
+		return true, nil
+	}
+	if schedule.LastRunName == nil {
+		return false, nil
+	}
+
+	run, err := s.config.RunStore.Get(ctx, *schedule.LastRunName)
+	if errors.Is(err, runs.ErrNotFound) {
+		// the firing failed before the run was recorded
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !runs.IsTerminal(run.State), nil
+}
+
+// fire launches a run of the schedule unless it is paused or its previous
+// run is active
+func (s *Scheduler) fire(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), fireTimeout)
+	defer cancel()
+
+	schedule, ok := s.claim(ctx, name)
+	if !ok {
+		return
+	}
+	s.launch(ctx, schedule)
+}
+
+// claim decides whether the schedule fires now and marks it as firing
+func (s *Scheduler) claim(ctx context.Context, name string) (*model.Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, err := s.store.Get(ctx, name)
+	if err != nil {
+		s.logger.Error("failed to fire schedule", "schedule", name, "error", err)
+		return nil, false
+	}
+	if schedule.Paused {
+		return nil, false
+	}
+
+	active, err := s.active(ctx, schedule)
+	if err != nil {
+		s.logger.Error("failed to fire schedule", "schedule", name, "error", err)
+		return nil, false
+	}
+	if active {
+		previous := ""
+		if schedule.LastRunName != nil {
+			previous = *schedule.LastRunName
+		}
+
+		if schedule.Overlap != model.ScheduleOverlapQueue {
+			s.logger.Info("skipping schedule firing, previous run is active", "schedule", name, "run_name", previous)
+			return nil, false
+		}
+
+		_, err = s.store.Update(ctx, name, func(schedule *model.Schedule) error {
+			schedule.PendingFire = true
+			return nil
+		})
+		if err != nil {
+			s.logger.Error("failed to defer schedule firing", "schedule", name, "error", err)
+		}
+		s.logger.Info("deferring schedule firing until the previous run ends", "schedule", name, "run_name", previous)
+		return nil, false
+	}
+
+	s.firing[name] = true
+	return schedule, true
+}
+
+func (s *Scheduler) launch(ctx context.Context, schedule *model.Schedule) {
+	name := schedule.Name
+	defer func() {
+		s.mu.Lock()
+		delete(s.firing, name)
+		s.mu.Unlock()
+	}()
+
+	firedAt := time.Now().UTC()
+	runName := RunName(schedule.RunNamePrefix, firedAt)
+
+	// the run is recorded first so it counts as the previous run as soon
+	// as it exists
+	schedule, err := s.store.Update(ctx, name, func(schedule *model.Schedule) error {
+		ts := firedAt.Format(time.RFC3339)
+		schedule.LastFiredAt = &ts
+		schedule.LastRunName = &runName
+		schedule.LastError = nil
+		schedule.PendingFire = false
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("failed to fire schedule", "schedule", name, "error", err)
+		return
+	}
+
+	s.logger.Info("firing schedule", "schedule", name, "run_name", runName)
+	fireErr := s.config.Fire(ctx, *schedule, runName)
+	if fireErr == nil {
+		return
+	}
+
+	s.logger.Error("scheduled run failed to launch", "schedule", name, "run_name", runName, "error", fireErr)
+	_, err = s.store.Update(ctx, name, func(schedule *model.Schedule) error {
+		msg := fireErr.Error()
+		schedule.LastError = &msg
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("failed to record schedule error", "schedule", name, "error", err)
+	}
+}
+
+// runFinished fires the deferred firing of the schedule whose run ended.
+// Listing under the lock orders it with claim: a firing deferred before is
+// listed, a claim after finds the run ended as the run store records the end
+// before the event is published.
+func (s *Scheduler) runFinished(runName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	schedules, err := s.store.List(ctx)
+	s.mu.Unlock()
+	if err != nil {
+		s.logger.Error("failed to list schedules", "error", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		if schedule.PendingFire && schedule.LastRunName != nil && *schedule.LastRunName == runName {
+			go s.fire(schedule.Name)
+		}
+	}
+}
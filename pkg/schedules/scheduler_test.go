@@ -0,0 +1,170 @@
+package schedules
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/natstest"
+	"nf-shard-orchestrator/pkg/runs"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fired struct {
+	mu       sync.Mutex
+	runNames []string
+}
+
+func (f *fired) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.runNames...)
+}
+
+func newTestScheduler(t *testing.T) (*Scheduler, *runs.Store, *fired) {
+	t.Helper()
+
+	nc, js := natstest.Start(t)
+
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	runStore, err := runs.NewStore(ctx, nc, js, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(ctx, js)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fired{}
+	s := NewScheduler(Config{
+		Logger:   logger,
+		Nc:       nc,
+		Store:    store,
+		RunStore: runStore,
+		Fire: func(ctx context.Context, schedule model.Schedule, runName string) error {
+			f.mu.Lock()
+			f.runNames = append(f.runNames, runName)
+			f.mu.Unlock()
+
+			_, err := runStore.Create(ctx, model.Run{RunName: runName, Executor: schedule.Executor, PipelineURL: schedule.PipelineURL})
+			return err
+		},
+	})
+	err = s.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+
+	return s, runStore, f
+}
+
+func TestRunName(t *testing.T) {
+	at := time.Date(2026, 3, 14, 2, 0, 5, 0, time.FixedZone("CET", 3600))
+	if got := RunName("nightly-qc", at); got != "nightly-qc-20260314-010005" {
+		t.Errorf("RunName() = %q", got)
+	}
+	if !runs.ValidName(RunName("nightly-qc", at)) {
+		t.Error("expected scheduled run name to be a valid run name")
+	}
+}
+
+func TestSchedulerCreate(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestScheduler(t)
+
+	_, err := s.Create(ctx, model.Schedule{Name: "nightly qc", Cron: "0 2 * * *"})
+	if !errors.Is(err, runs.ErrInvalidName) {
+		t.Errorf("Create() with invalid name error = %v, want %v", err, runs.ErrInvalidName)
+	}
+
+	_, err = s.Create(ctx, model.Schedule{Name: "nightly-qc", Cron: "0 25 * * *"})
+	if err == nil || !strings.Contains(err.Error(), "invalid cron expression") {
+		t.Errorf("Create() with invalid cron error = %v", err)
+	}
+
+	schedule, err := s.Create(ctx, model.Schedule{Name: "nightly-qc", Cron: "@daily"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.RunNamePrefix != "nightly-qc" || schedule.Overlap != model.ScheduleOverlapSkip {
+		t.Errorf("schedule = %+v, want defaults", schedule)
+	}
+
+	next, ok := s.Next("nightly-qc")
+	if !ok || next.Hour() != 0 || next.Minute() != 0 || next.Before(time.Now()) {
+		t.Errorf("Next() = %v %v, want next midnight", next, ok)
+	}
+
+	_, err = s.Create(ctx, model.Schedule{Name: "nightly-qc", Cron: "@daily"})
+	if !errors.Is(err, ErrExists) {
+		t.Errorf("Create() of existing schedule error = %v, want %v", err, ErrExists)
+	}
+
+	err = s.Delete(ctx, "nightly-qc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Next("nightly-qc"); ok {
+		t.Error("expected deleted schedule not to fire")
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	ctx := context.Background()
+	s, runStore, f := newTestScheduler(t)
+
+	for _, schedule := range []model.Schedule{
+		{Name: "skip", Cron: "@yearly", Overlap: model.ScheduleOverlapSkip},
+		{Name: "queue", Cron: "@yearly", Overlap: model.ScheduleOverlapQueue},
+		{Name: "paused", Cron: "@yearly"},
+	} {
+		_, err := s.Create(ctx, schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := s.SetPaused(ctx, "paused", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"skip", "queue", "paused", "skip", "queue"} {
+		s.fire(name)
+	}
+
+	names := f.names()
+	if len(names) != 2 || !strings.HasPrefix(names[0], "skip-") || !strings.HasPrefix(names[1], "queue-") {
+		t.Fatalf("fired runs = %v, want one of skip and queue", names)
+	}
+
+	queued, err := s.store.Get(ctx, "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !queued.PendingFire || *queued.LastRunName != names[1] {
+		t.Errorf("queue schedule = %+v, want deferred firing", queued)
+	}
+
+	// the deferred firing follows the end of the previous run
+	time.Sleep(time.Second)
+	_, err = runStore.Transition(ctx, names[1], model.RunStateCancelled, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(f.names()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	names = f.names()
+	if len(names) != 3 || !strings.HasPrefix(names[2], "queue-") || names[2] == names[1] {
+		t.Fatalf("fired runs = %v, want a second run of queue", names)
+	}
+}
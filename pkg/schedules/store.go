@@ -0,0 +1,159 @@
+package schedules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nf-shard-orchestrator/graph/model"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const BucketName = "SCHEDULES"
+
+var (
+	ErrNotFound = errors.New("schedule not found")
+	ErrExists   = errors.New("schedule already exists")
+)
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// Store persists schedules in a JetStream key-value bucket so they survive
+// worker restarts.
+type Store struct {
+	kv jetstream.KeyValue
+}
+
+func NewStore(ctx context.Context, js jetstream.JetStream) (*Store, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      BucketName,
+		Description: "nf-shard run schedules",
+		Storage:     jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule bucket: %w", err)
+	}
+
+	return &Store{kv: kv}, nil
+}
+
+func (s *Store) Create(ctx context.Context, schedule model.Schedule) (*model.Schedule, error) {
+	ts := now()
+	schedule.CreatedAt = ts
+	schedule.UpdatedAt = ts
+
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+
+	_, err = s.kv.Create(ctx, schedule.Name, data)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return nil, fmt.Errorf("%w: %s", ErrExists, schedule.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+func (s *Store) Get(ctx context.Context, name string) (*model.Schedule, error) {
+	schedule, _, err := s.get(ctx, name)
+	return schedule, err
+}
+
+func (s *Store) get(ctx context.Context, name string) (*model.Schedule, uint64, error) {
+	entry, err := s.kv.Get(ctx, name)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read schedule: %w", err)
+	}
+
+	var schedule model.Schedule
+	err = json.Unmarshal(entry.Value(), &schedule)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+
+	return &schedule, entry.Revision(), nil
+}
+
+// Update applies fn to the stored schedule, retrying when a concurrent
+// writer changed it in the meantime.
+func (s *Store) Update(ctx context.Context, name string, fn func(schedule *model.Schedule) error) (*model.Schedule, error) {
+	for {
+		schedule, rev, err := s.get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fn(schedule); err != nil {
+			return nil, err
+		}
+		schedule.UpdatedAt = now()
+
+		data, err := json.Marshal(schedule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal schedule: %w", err)
+		}
+
+		_, err = s.kv.Update(ctx, name, data, rev)
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to store schedule: %w", err)
+		}
+
+		return schedule, nil
+	}
+}
+
+func (s *Store) Delete(ctx context.Context, name string) error {
+	if _, err := s.Get(ctx, name); err != nil {
+		return err
+	}
+
+	err := s.kv.Delete(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	return nil
+}
+
+// List returns all schedules sorted by name
+func (s *Store) List(ctx context.Context) ([]*model.Schedule, error) {
+	keys, err := s.kv.Keys(ctx)
+	if errors.Is(err, jetstream.ErrNoKeysFound) {
+		return []*model.Schedule{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	schedules := make([]*model.Schedule, 0, len(keys))
+	for _, key := range keys {
+		schedule, err := s.Get(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			// deleted since listing the keys
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+	return schedules, nil
+}
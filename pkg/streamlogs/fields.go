@@ -0,0 +1,54 @@
+package logstream
+
+import (
+	"nf-shard-orchestrator/graph/model"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// leading level markers as printed by nextflow, e.g. `ERROR ~`, `WARN:` or `[DEBUG]`
+var levelRegex = regexp.MustCompile(`^\s*\[?(?i:(DEBUG|TRACE|INFO|WARN|WARNING|ERROR|ERR|FATAL|SEVERE))\b`)
+
+// ParseLevel derives the level of a log line from its message, falling back
+// to ERROR for stderr and INFO for everything else.
+func ParseLevel(message string, stream model.LogStream) model.LogLevel {
+	if m := levelRegex.FindStringSubmatch(message); m != nil {
+		switch strings.ToUpper(m[1]) {
+		case "DEBUG", "TRACE":
+			return model.LogLevelDebug
+		case "INFO":
+			return model.LogLevelInfo
+		case "WARN", "WARNING":
+			return model.LogLevelWarn
+		default:
+			return model.LogLevelError
+		}
+	}
+
+	if strings.Contains(message, "Error executing process") {
+		return model.LogLevelError
+	}
+
+	if stream == model.LogStreamStderr {
+		return model.LogLevelError
+	}
+	return model.LogLevelInfo
+}
+
+// withDefaults fills structured fields that were not set by the publisher
+func withDefaults(log model.Log) model.Log {
+	if log.Timestamp == "" {
+		log.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	if log.Stream == "" {
+		log.Stream = model.LogStreamSystem
+	}
+	if log.Phase == "" {
+		log.Phase = model.LogPhaseRun
+	}
+	if log.Level == "" {
+		log.Level = ParseLevel(log.Message, log.Stream)
+	}
+	return log
+}
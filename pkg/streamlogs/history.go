@@ -0,0 +1,212 @@
+package logstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/cache"
+	"nf-shard-orchestrator/pkg/runs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	DefaultPageLimit = 500
+	MaxPageLimit     = 5000
+
+	readTimeout = 30 * time.Second
+)
+
+// History reads past logs of runs from the log stream. Logs read once are
+// kept in the cache, so later reads only fetch what was published since.
+type History struct {
+	js    jetstream.JetStream
+	cache *cache.Cache[model.Log]
+	mutex sync.Mutex
+	// reads of a run are serialised so its logs are fetched once
+	locks map[string]*runLock
+}
+
+type runLock struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+func NewHistory(js jetstream.JetStream, logCache *cache.Cache[model.Log]) *History {
+	return &History{
+		js:    js,
+		cache: logCache,
+		locks: make(map[string]*runLock),
+	}
+}
+
+// lock locks the history of a run and returns its unlock function
+func (h *History) lock(runName string) func() {
+	h.mutex.Lock()
+	l, ok := h.locks[runName]
+	if !ok {
+		l = &runLock{}
+		h.locks[runName] = l
+	}
+	l.refs++
+	h.mutex.Unlock()
+
+	l.mutex.Lock()
+	return func() {
+		l.mutex.Unlock()
+
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(h.locks, runName)
+		}
+	}
+}
+
+// Logs returns all stored logs of the run in publish order.
+func (h *History) Logs(ctx context.Context, runName string) ([]model.Log, error) {
+	// names are subject tokens, wildcards would read the logs of other runs
+	if !runs.ValidName(runName) {
+		return nil, fmt.Errorf("%w: %q", runs.ErrInvalidName, runName)
+	}
+
+	unlock := h.lock(runName)
+	defer unlock()
+
+	last, err := h.lastSeq(ctx, runName)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.cache.Evicted(runName) {
+		// the cache only holds the tail of this run
+		return h.read(ctx, runName, 0, last)
+	}
+
+	cached := h.cache.Get(runName)
+	var after uint64
+	if len(cached) > 0 {
+		after = uint64(cached[len(cached)-1].Seq)
+	}
+	if last <= after {
+		return cached, nil
+	}
+
+	fresh, err := h.read(ctx, runName, after, last)
+	if err != nil {
+		return nil, err
+	}
+	for _, log := range fresh {
+		h.cache.Add(runName, log)
+	}
+
+	return append(cached, fresh...), nil
+}
+
+// Expire lets the cached logs of a finished run age out.
+func (h *History) Expire(runName string) {
+	h.cache.Expire(runName)
+}
+
+// lastSeq returns the sequence of the run's last log, 0 if it has none
+func (h *History) lastSeq(ctx context.Context, runName string) (uint64, error) {
+	stream, err := h.js.Stream(ctx, StreamName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open log stream: %w", err)
+	}
+
+	last, err := stream.GetLastMsgForSubject(ctx, Subject(runName))
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read last log: %w", err)
+	}
+
+	return last.Sequence, nil
+}
+
+// read returns the run's logs published after the given sequence up to last
+func (h *History) read(ctx context.Context, runName string, after uint64, last uint64) ([]model.Log, error) {
+	if last <= after {
+		return []model.Log{}, nil
+	}
+
+	// the last message may be removed by retention while reading, so don't
+	// wait for it forever
+	subCtx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+
+	logs, err := Subscribe(subCtx, h.js, runName, after)
+	if err != nil {
+		return nil, err
+	}
+
+	read := make([]model.Log, 0)
+	for log := range logs {
+		read = append(read, *log)
+		if uint64(log.Seq) >= last {
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return read, nil
+}
+
+// Page returns a window of the run's logs whose message contains search,
+// ignoring case. An empty search matches every log.
+func (h *History) Page(ctx context.Context, runName string, offset int, limit int, search string) (*model.LogPage, error) {
+	logs, err := h.Logs(ctx, runName)
+	if err != nil {
+		return nil, err
+	}
+
+	if search != "" {
+		search = strings.ToLower(search)
+		matched := make([]model.Log, 0)
+		for _, log := range logs {
+			if strings.Contains(strings.ToLower(log.Message), search) {
+				matched = append(matched, log)
+			}
+		}
+		logs = matched
+	}
+
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	total := len(logs)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	items := make([]*model.Log, 0, end-offset)
+	for i := offset; i < end; i++ {
+		log := logs[i]
+		items = append(items, &log)
+	}
+
+	return &model.LogPage{
+		Items: items,
+		Total: total,
+	}, nil
+}
@@ -0,0 +1,161 @@
+package logstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/cache"
+	"nf-shard-orchestrator/pkg/runs"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func publish(t *testing.T, js jetstream.JetStream, runName string, messages ...string) {
+	t.Helper()
+
+	for _, message := range messages {
+		if err := PublishLog(js, runName, model.Log{Message: message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func messages(logs []model.Log) []string {
+	result := make([]string, 0, len(logs))
+	for _, log := range logs {
+		result = append(result, log.Message)
+	}
+	return result
+}
+
+func TestHistoryLogs(t *testing.T) {
+	js := newTestStream(t)
+	logCache := cache.NewCache[model.Log](cache.Config{})
+	h := NewHistory(js, logCache)
+	ctx := context.Background()
+
+	logs, err := h.Logs(ctx, "run-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 0 {
+		t.Errorf("logs of run without logs = %v", logs)
+	}
+
+	publish(t, js, "run-a", "one", "two")
+	publish(t, js, "run-b", "other run")
+
+	logs, err = h.Logs(ctx, "run-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(messages(logs)); got != "[one two]" {
+		t.Errorf("logs = %s, want [one two]", got)
+	}
+
+	// later reads only add what was published since
+	publish(t, js, "run-a", "three")
+	logs, err = h.Logs(ctx, "run-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(messages(logs)); got != "[one two three]" {
+		t.Errorf("logs = %s, want [one two three]", got)
+	}
+	if cached := logCache.Get("run-a"); len(cached) != 3 {
+		t.Errorf("cached %d logs, want 3", len(cached))
+	}
+
+	for _, runName := range []string{"*", ">", "run-a.x", ""} {
+		_, err = h.Logs(ctx, runName)
+		if !errors.Is(err, runs.ErrInvalidName) {
+			t.Errorf("Logs(%q) error = %v, want %v", runName, err, runs.ErrInvalidName)
+		}
+	}
+	if logCache.Stats().Keys != 1 {
+		t.Errorf("cache keys = %d, want 1", logCache.Stats().Keys)
+	}
+}
+
+func TestHistoryPage(t *testing.T) {
+	js := newTestStream(t)
+	h := NewHistory(js, cache.NewCache[model.Log](cache.Config{}))
+	ctx := context.Background()
+
+	publish(t, js, "run-a", "Starting", "process A", "process B", "ERROR in process C", "done")
+
+	tests := []struct {
+		offset, limit int
+		search        string
+		want          string
+		total         int
+	}{
+		{0, 0, "", "[Starting process A process B ERROR in process C done]", 5},
+		{1, 2, "", "[process A process B]", 5},
+		{-1, 2, "", "[Starting process A]", 5},
+		{10, 2, "", "[]", 5},
+		{0, 0, "PROCESS", "[process A process B ERROR in process C]", 3},
+		{1, 1, "process", "[process B]", 3},
+		{0, 0, "missing", "[]", 0},
+	}
+
+	for _, tt := range tests {
+		page, err := h.Page(ctx, "run-a", tt.offset, tt.limit, tt.search)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		items := make([]model.Log, 0, len(page.Items))
+		for _, item := range page.Items {
+			items = append(items, *item)
+		}
+		if got := fmt.Sprint(messages(items)); got != tt.want || page.Total != tt.total {
+			t.Errorf("Page(%d, %d, %q) = %s of %d, want %s of %d", tt.offset, tt.limit, tt.search, got, page.Total, tt.want, tt.total)
+		}
+	}
+
+	_, err := h.Page(ctx, "run-*", 0, 0, "")
+	if !errors.Is(err, runs.ErrInvalidName) {
+		t.Errorf("Page() error = %v, want %v", err, runs.ErrInvalidName)
+	}
+}
+
+func TestServeText(t *testing.T) {
+	js := newTestStream(t)
+	h := NewHistory(js, cache.NewCache[model.Log](cache.Config{}))
+
+	publish(t, js, "run-a", "line 1\n", "line 2")
+
+	router := chi.NewRouter()
+	router.Get("/runs/{runName}/logs.txt", h.ServeText)
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/runs/run-a/logs.txt", http.StatusOK, "line 1\nline 2\n"},
+		{"/runs/run-b/logs.txt", http.StatusNotFound, "404 page not found\n"},
+		{"/runs/*/logs.txt", http.StatusBadRequest, "invalid run name: \"*\"\n"},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if recorder.Code != tt.status || recorder.Body.String() != tt.body {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, recorder.Code, recorder.Body.String(), tt.status, tt.body)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/runs/run-a/logs.txt", nil))
+	if got := recorder.Header().Get("Content-Disposition"); got != `attachment; filename="run-a.log"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+}
@@ -0,0 +1,42 @@
+package logstream
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"nf-shard-orchestrator/pkg/runs"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// ServeText writes all logs of the run in the `runName` URL parameter as a
+// plain text download, one message per line.
+func (h *History) ServeText(w http.ResponseWriter, r *http.Request) {
+	runName := chi.URLParam(r, "runName")
+
+	logs, err := h.Logs(r.Context(), runName)
+	if errors.Is(err, runs.ErrInvalidName) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(logs) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runName+".log"))
+
+	buf := bufio.NewWriter(w)
+	for _, log := range logs {
+		_, _ = buf.WriteString(strings.TrimRight(log.Message, "\n"))
+		_ = buf.WriteByte('\n')
+	}
+	_ = buf.Flush()
+}
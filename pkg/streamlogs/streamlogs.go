@@ -1,17 +1,25 @@
 package logstream
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/nats-io/nats.go"
 	"nf-shard-orchestrator/graph/model"
-	"nf-shard-orchestrator/pkg/cache"
 	"regexp"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
 )
 
 const (
 	StreamName    = "WORKFLOW_LOGS"
 	SubjectPrefix = "workflows"
+
+	DefaultMaxAge   = 30 * 24 * time.Hour
+	DefaultMaxBytes = 1 << 30
+
+	publishTimeout = 5 * time.Second
 )
 
 var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
@@ -20,21 +28,132 @@ func stripAnsiCodes(s string) string {
 	return ansiRegex.ReplaceAllString(s, "")
 }
 
-func PublishLog(nc *nats.Conn, runName string, log model.Log, logCache *cache.Cache[model.Log]) error {
-	log.Message = stripAnsiCodes(log.Message)
-	logCache.Add(runName, log)
+func Subject(runName string) string {
+	return fmt.Sprintf("%s.%s", SubjectPrefix, runName)
+}
+
+// CreateStream creates or updates the file backed stream holding workflow
+// logs. Logs older than maxAge or above maxBytes in total are discarded.
+func CreateStream(ctx context.Context, js jetstream.JetStream, maxAge time.Duration, maxBytes int64) (jetstream.Stream, error) {
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:        StreamName,
+		Description: "nf-shard workflow logs",
+		Subjects:    []string{SubjectPrefix + ".>"},
+		Storage:     jetstream.FileStorage,
+		Retention:   jetstream.LimitsPolicy,
+		Discard:     jetstream.DiscardOld,
+		MaxAge:      maxAge,
+		MaxBytes:    maxBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log stream: %w", err)
+	}
+
+	return stream, nil
+}
+
+// decode unmarshals a log message and stamps it with its stream sequence
+func decode(msg jetstream.Msg) (*model.Log, error) {
+	var log model.Log
+	if err := json.Unmarshal(msg.Data(), &log); err != nil {
+		return nil, err
+	}
+	// logs published before structured fields were added
+	log = withDefaults(log)
 
-	subject := fmt.Sprintf("%s.%s", SubjectPrefix, runName)
+	meta, err := msg.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	log.Seq = int(meta.Sequence.Stream)
+
+	return &log, nil
+}
+
+// PublishLog stores a log line of the run. Timestamp, stream, phase and level
+// default to now, SYSTEM, RUN and the level parsed from the message.
+func PublishLog(js jetstream.JetStream, runName string, log model.Log) error {
+	log.Message = stripAnsiCodes(log.Message)
+	log = withDefaults(log)
 
 	logData, err := json.Marshal(log)
 	if err != nil {
 		return fmt.Errorf("failed to marshal log: %w", err)
 	}
 
-	err = nc.Publish(subject, logData)
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	_, err = js.Publish(ctx, Subject(runName), logData)
 	if err != nil {
 		return fmt.Errorf("failed to publish log: %w", err)
 	}
 
 	return nil
 }
+
+// Subscribe replays the logs of a run published after the given sequence,
+// or from the beginning when afterSeq is 0, and then follows new logs until
+// ctx is cancelled. Backlog and live logs are delivered by a single ordered
+// consumer, so they arrive in publish order without gaps or duplicates.
+//
+// Sequence numbers are the stream sequences of the log messages. They grow
+// monotonically but are shared between runs, so they are not contiguous.
+func Subscribe(ctx context.Context, js jetstream.JetStream, runName string, afterSeq uint64) (<-chan *model.Log, error) {
+	cfg := jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{Subject(runName)},
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	}
+	if afterSeq > 0 {
+		cfg.DeliverPolicy = jetstream.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = afterSeq + 1
+	}
+
+	consumer, err := js.OrderedConsumer(ctx, StreamName, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log consumer: %w", err)
+	}
+
+	iter, err := consumer.Messages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume logs: %w", err)
+	}
+
+	// Create a buffered channel to handle log spikes
+	logChan := make(chan *model.Log, 1000)
+
+	go func() {
+		<-ctx.Done()
+		iter.Stop()
+	}()
+
+	go func() {
+		defer close(logChan)
+
+		for {
+			msg, err := iter.Next()
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				return
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+
+			log, err := decode(msg)
+			if err != nil {
+				continue
+			}
+
+			select {
+			case logChan <- log:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return logChan, nil
+}
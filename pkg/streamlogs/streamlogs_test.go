@@ -0,0 +1,140 @@
+package logstream
+
+import (
+	"context"
+	"fmt"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/natstest"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func newTestStream(t *testing.T) jetstream.JetStream {
+	t.Helper()
+
+	_, js := natstest.Start(t)
+
+	_, err := CreateStream(context.Background(), js, time.Hour, DefaultMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+func receive(t *testing.T, logs <-chan *model.Log, n int) []*model.Log {
+	t.Helper()
+
+	received := make([]*model.Log, 0, n)
+	for len(received) < n {
+		select {
+		case log := <-logs:
+			received = append(received, log)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d logs, want %d", len(received), n)
+		}
+	}
+	return received
+}
+
+func TestSubscribeReplaysAndFollows(t *testing.T) {
+	js := newTestStream(t)
+
+	for i := 0; i < 3; i++ {
+		if err := PublishLog(js, "run-a", model.Log{Message: fmt.Sprintf("\x1b[32mline %d\x1b[0m", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := PublishLog(js, "run-b", model.Log{Message: "other run"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logs, err := Subscribe(ctx, js, "run-a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := receive(t, logs, 3)
+	for i, log := range got {
+		if want := fmt.Sprintf("line %d", i); log.Message != want {
+			t.Errorf("log %d = %q, want %q", i, log.Message, want)
+		}
+		if i > 0 && log.Seq <= got[i-1].Seq {
+			t.Errorf("log %d seq = %d, not after %d", i, log.Seq, got[i-1].Seq)
+		}
+	}
+
+	if err := PublishLog(js, "run-a", model.Log{Message: "live"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, logs, 1); got[0].Message != "live" {
+		t.Errorf("live log = %q, want %q", got[0].Message, "live")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-logs:
+		if ok {
+			t.Error("received log after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("log channel not closed after cancel")
+	}
+}
+
+func TestSubscribeResumesAfterSeq(t *testing.T) {
+	js := newTestStream(t)
+
+	for i := 0; i < 5; i++ {
+		if err := PublishLog(js, "run-a", model.Log{Message: fmt.Sprintf("line %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := PublishLog(js, "run-b", model.Log{Message: "noise"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	all, err := Subscribe(ctx, js, "run-a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := receive(t, all, 5)
+
+	resumed, err := Subscribe(ctx, js, "run-a", uint64(first[2].Seq))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := receive(t, resumed, 2)
+	if got[0].Message != "line 3" || got[1].Message != "line 4" {
+		t.Errorf("resumed logs = %q, %q, want line 3, line 4", got[0].Message, got[1].Message)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		message  string
+		stream   model.LogStream
+		expected model.LogLevel
+	}{
+		{"ERROR ~ No such file: main.nf", model.LogStreamStdout, model.LogLevelError},
+		{"WARN: Access to undefined parameter `foo`", model.LogStreamStdout, model.LogLevelWarn},
+		{"[DEBUG] resolving revision", model.LogStreamStdout, model.LogLevelDebug},
+		{"Error executing process > 'FASTQC (1)'", model.LogStreamStdout, model.LogLevelError},
+		{"executor >  awsbatch (3)", model.LogStreamStdout, model.LogLevelInfo},
+		{"Picked up _JAVA_OPTIONS", model.LogStreamStderr, model.LogLevelError},
+		{"warnings are fine", model.LogStreamSystem, model.LogLevelInfo},
+	}
+
+	for _, tt := range tests {
+		if got := ParseLevel(tt.message, tt.stream); got != tt.expected {
+			t.Errorf("ParseLevel(%q, %s) = %s, want %s", tt.message, tt.stream, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package templates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nf-shard-orchestrator/graph/model"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const BucketName = "LAUNCH_TEMPLATES"
+
+var (
+	ErrNotFound = errors.New("launch template not found")
+	ErrInvalid  = errors.New("invalid launch template")
+)
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// Store persists launch templates in a JetStream key-value bucket, keyed
+// by their generated ID.
+type Store struct {
+	kv jetstream.KeyValue
+}
+
+func NewStore(ctx context.Context, js jetstream.JetStream) (*Store, error) {
+	kv, err := js.CreateOrUpdateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      BucketName,
+		Description: "nf-shard launch templates",
+		Storage:     jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create launch template bucket: %w", err)
+	}
+
+	return &Store{kv: kv}, nil
+}
+
+func validate(template model.LaunchTemplate) error {
+	if strings.TrimSpace(template.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if strings.TrimSpace(template.PipelineURL) == "" {
+		return fmt.Errorf("%w: pipeline url is required", ErrInvalid)
+	}
+	return nil
+}
+
+// Create stores a new template under a generated ID
+func (s *Store) Create(ctx context.Context, template model.LaunchTemplate) (*model.LaunchTemplate, error) {
+	if err := validate(template); err != nil {
+		return nil, err
+	}
+
+	ts := now()
+	template.ID = uuid.NewString()
+	template.CreatedAt = ts
+	template.UpdatedAt = ts
+
+	data, err := json.Marshal(template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal launch template: %w", err)
+	}
+
+	_, err = s.kv.Create(ctx, template.ID, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store launch template: %w", err)
+	}
+
+	return &template, nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (*model.LaunchTemplate, error) {
+	template, _, err := s.get(ctx, id)
+	return template, err
+}
+
+func (s *Store) get(ctx context.Context, id string) (*model.LaunchTemplate, uint64, error) {
+	if uuid.Validate(id) != nil {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	entry, err := s.kv.Get(ctx, id)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read launch template: %w", err)
+	}
+
+	var template model.LaunchTemplate
+	err = json.Unmarshal(entry.Value(), &template)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal launch template: %w", err)
+	}
+
+	return &template, entry.Revision(), nil
+}
+
+// Replace overwrites the template's settings, keeping its ID and creation
+// time
+func (s *Store) Replace(ctx context.Context, id string, template model.LaunchTemplate) (*model.LaunchTemplate, error) {
+	if err := validate(template); err != nil {
+		return nil, err
+	}
+
+	for {
+		current, rev, err := s.get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		template.ID = current.ID
+		template.CreatedAt = current.CreatedAt
+		template.UpdatedAt = now()
+
+		data, err := json.Marshal(template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal launch template: %w", err)
+		}
+
+		_, err = s.kv.Update(ctx, id, data, rev)
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			// revision changed underneath us
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to store launch template: %w", err)
+		}
+
+		return &template, nil
+	}
+}
+
+func (s *Store) Delete(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+
+	err := s.kv.Delete(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete launch template: %w", err)
+	}
+	return nil
+}
+
+// List returns all templates sorted by name
+func (s *Store) List(ctx context.Context) ([]*model.LaunchTemplate, error) {
+	keys, err := s.kv.Keys(ctx)
+	if errors.Is(err, jetstream.ErrNoKeysFound) {
+		return []*model.LaunchTemplate{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list launch templates: %w", err)
+	}
+
+	templates := make([]*model.LaunchTemplate, 0, len(keys))
+	for _, key := range keys {
+		template, err := s.Get(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			// deleted since listing the keys
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name == templates[j].Name {
+			return templates[i].ID < templates[j].ID
+		}
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// MergeParameters returns the base parameters with those of the same key
+// replaced by the overrides, in place, and the other overrides appended
+func MergeParameters(base []*model.Parameter, overrides []*model.Parameter) []*model.Parameter {
+	merged := make([]*model.Parameter, 0, len(base)+len(overrides))
+	index := make(map[string]int, len(base))
+	for _, p := range base {
+		if i, ok := index[p.Key]; ok {
+			merged[i] = p
+			continue
+		}
+		index[p.Key] = len(merged)
+		merged = append(merged, p)
+	}
+
+	for _, p := range overrides {
+		if i, ok := index[p.Key]; ok {
+			merged[i] = p
+			continue
+		}
+		index[p.Key] = len(merged)
+		merged = append(merged, p)
+	}
+
+	return merged
+}
+
+// MergeParams returns the base params with the top-level keys of the
+// overrides replaced
+func MergeParams(base map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]interface{}, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Command builds the run job command of a template with the per-run
+// overrides applied
+func Command(template model.LaunchTemplate, overrides model.TemplateOverrides) model.RunJobCommand {
+	base := make([]*model.Parameter, 0, len(template.Parameters))
+	for _, p := range template.Parameters {
+		base = append(base, &model.Parameter{Key: p.Key, Value: p.Value, IsFlag: p.IsFlag})
+	}
+
+	revision := template.Revision
+	if overrides.Revision != nil {
+		revision = overrides.Revision
+	}
+
+	executor := &model.Executor{
+		Name:            template.Executor,
+		ComputeOverride: template.ComputeOverride,
+	}
+	if overrides.Executor != nil {
+		executor.Name = *overrides.Executor
+	}
+	if overrides.ComputeOverride != nil {
+		executor.ComputeOverride = *overrides.ComputeOverride
+	}
+
+	return model.RunJobCommand{
+		RunName:     overrides.RunName,
+		PipelineURL: template.PipelineURL,
+		Revision:    revision,
+		Executor:    executor,
+		Parameters:  MergeParameters(base, overrides.Parameters),
+		Params:      MergeParams(template.Params, overrides.Params),
+		User:        overrides.User,
+		Priority:    overrides.Priority,
+	}
+}
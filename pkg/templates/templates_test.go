@@ -0,0 +1,149 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"nf-shard-orchestrator/graph/model"
+	"nf-shard-orchestrator/pkg/natstest"
+	"reflect"
+	"testing"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	_, js := natstest.Start(t)
+
+	store, err := NewStore(context.Background(), js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func param(key, value string) *model.Parameter {
+	return &model.Parameter{Key: key, Value: value}
+}
+
+func TestMergeParameters(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      []*model.Parameter
+		overrides []*model.Parameter
+		want      []*model.Parameter
+	}{
+		{
+			name: "no overrides",
+			base: []*model.Parameter{param("--input", "samples.csv"), param("--genome", "GRCh38")},
+			want: []*model.Parameter{param("--input", "samples.csv"), param("--genome", "GRCh38")},
+		},
+		{
+			name:      "overrides replace in place and new keys are appended",
+			base:      []*model.Parameter{param("--input", "samples.csv"), param("--genome", "GRCh38")},
+			overrides: []*model.Parameter{param("--outdir", "s3://out"), param("--input", "batch-2.csv")},
+			want:      []*model.Parameter{param("--input", "batch-2.csv"), param("--genome", "GRCh38"), param("--outdir", "s3://out")},
+		},
+		{
+			name:      "flags override values",
+			base:      []*model.Parameter{param("-profile", "test")},
+			overrides: []*model.Parameter{{Key: "-profile", IsFlag: true}},
+			want:      []*model.Parameter{{Key: "-profile", IsFlag: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeParameters(tt.base, tt.overrides)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeParameters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	revision := "3.14.0"
+	template := model.LaunchTemplate{
+		PipelineURL:     "nf-core/rnaseq",
+		Revision:        &revision,
+		Executor:        "awsbatch",
+		ComputeOverride: "process.queue = 'default'",
+		Parameters:      []*model.RunParameter{{Key: "--genome", Value: "GRCh38"}},
+		Params:          map[string]interface{}{"input": "samples.csv", "skip_qc": false},
+	}
+
+	queue := "process.queue = 'spot'"
+	dev := "dev"
+	user := "ann"
+	cmd := Command(template, model.TemplateOverrides{
+		RunName:         "rnaseq-batch-2",
+		Revision:        &dev,
+		Parameters:      []*model.Parameter{param("--genome", "GRCm39"), param("--skip_qc", "true")},
+		ComputeOverride: &queue,
+		Params:          map[string]interface{}{"skip_qc": true, "genomes": []interface{}{"GRCh38"}},
+		User:            &user,
+	})
+
+	if cmd.RunName != "rnaseq-batch-2" || cmd.PipelineURL != "nf-core/rnaseq" || *cmd.Revision != "dev" || *cmd.User != "ann" {
+		t.Errorf("command = %+v", cmd)
+	}
+	if cmd.Executor.Name != "awsbatch" || cmd.Executor.ComputeOverride != queue {
+		t.Errorf("executor = %+v, want awsbatch with the overridden config", cmd.Executor)
+	}
+	want := []string{"--genome", "GRCm39", "--skip_qc", "true"}
+	if !reflect.DeepEqual(cmd.Args(), want) {
+		t.Errorf("args = %v, want %v", cmd.Args(), want)
+	}
+	wantParams := map[string]interface{}{"input": "samples.csv", "skip_qc": true, "genomes": []interface{}{"GRCh38"}}
+	if !reflect.DeepEqual(cmd.Params, wantParams) {
+		t.Errorf("params = %v, want %v", cmd.Params, wantParams)
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	_, err := store.Create(ctx, model.LaunchTemplate{Name: "rnaseq"})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Create() without pipeline error = %v, want %v", err, ErrInvalid)
+	}
+
+	created, err := store.Create(ctx, model.LaunchTemplate{Name: "rnaseq", PipelineURL: "nf-core/rnaseq", Executor: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Create(ctx, model.LaunchTemplate{Name: "atacseq", PipelineURL: "nf-core/atacseq", Executor: "local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := store.Replace(ctx, created.ID, model.LaunchTemplate{Name: "rnaseq", PipelineURL: "nf-core/rnaseq", Executor: "awsbatch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ID != created.ID || updated.CreatedAt != created.CreatedAt || updated.Executor != "awsbatch" {
+		t.Errorf("updated = %+v", updated)
+	}
+
+	list, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "atacseq" || list[1].Executor != "awsbatch" {
+		t.Errorf("list = %+v", list)
+	}
+
+	err = store.Delete(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get(ctx, created.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of deleted template error = %v, want %v", err, ErrNotFound)
+	}
+	_, err = store.Get(ctx, "../RUNS")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of invalid id error = %v, want %v", err, ErrNotFound)
+	}
+}